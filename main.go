@@ -6,6 +6,7 @@ import (
 	"github.com/hashicorp/packer-plugin-sdk/plugin"
 	"github.com/hashicorp/packer-plugin-sdk/version"
 
+	testinfraPostProcessor "github.com/mschuchard/packer-plugin-testinfra/postprocessor"
 	testinfra "github.com/mschuchard/packer-plugin-testinfra/provisioner"
 )
 
@@ -14,6 +15,8 @@ func main() {
 	packerPluginSet := plugin.NewSet()
 	// register plugin provisioner
 	packerPluginSet.RegisterProvisioner(plugin.DEFAULT_NAME, new(testinfra.Provisioner))
+	// register plugin post-processor
+	packerPluginSet.RegisterPostProcessor(plugin.DEFAULT_NAME, new(testinfraPostProcessor.PostProcessor))
 	// set plugin version
 	pluginVersion := version.NewPluginVersion("1.6.1", "", "")
 	packerPluginSet.SetVersion(pluginVersion)
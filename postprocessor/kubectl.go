@@ -0,0 +1,85 @@
+package testinfra
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// duration to wait for a launched pod to become ready
+var kubectlPodTimeout = 5 * time.Minute
+
+// launch a throwaway pod from the container image artifact, and test it with the kubectl backend
+func (postProcessor *PostProcessor) testKubectlPod(ctx context.Context, ui packer.Ui, image string) error {
+	// unique pod name
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	podName := "packer-testinfra-" + hex.EncodeToString(suffix)
+	kubectlArgs := postProcessor.kubectlArgs()
+
+	// pod idles so that testinfra can execute within it
+	ui.Sayf("launching kubectl pod %s from image %s", podName, image)
+	runArgs := slices.Concat(kubectlArgs, []string{"run", podName, fmt.Sprintf("--image=%s", image), "--restart=Never"}, postProcessor.config.RunArgs, []string{"--command", "--", "sleep", "infinity"})
+	if output, err := exec.CommandContext(ctx, "kubectl", runArgs...).CombinedOutput(); err != nil {
+		ui.Errorf("kubectl pod launch failed: %s", strings.TrimSpace(string(output)))
+		return err
+	}
+
+	// delete pod upon completion, failure, or cancellation without waiting for termination
+	defer func() {
+		deleteArgs := slices.Concat(kubectlArgs, []string{"delete", "pod", podName, "--ignore-not-found", "--wait=false"})
+		if output, err := exec.Command("kubectl", deleteArgs...).CombinedOutput(); err != nil {
+			ui.Errorf("the kubectl pod %s could not be deleted: %s", podName, strings.TrimSpace(string(output)))
+		} else {
+			log.Printf("deleted kubectl pod: %s", podName)
+		}
+	}()
+
+	// wait for pod readiness
+	waitArgs := slices.Concat(kubectlArgs, []string{"wait", "--for=condition=Ready", fmt.Sprintf("pod/%s", podName), fmt.Sprintf("--timeout=%.0fs", kubectlPodTimeout.Seconds())})
+	if output, err := exec.CommandContext(ctx, "kubectl", waitArgs...).CombinedOutput(); err != nil {
+		ui.Errorf("kubectl pod did not become ready: %s", strings.TrimSpace(string(output)))
+		return errors.New("kubectl pod readiness failure")
+	}
+	ui.Sayf("kubectl pod %s is ready for Testinfra execution", podName)
+
+	// test pod with the provisioner pipeline
+	return postProcessor.provisioner.Provision(ctx, ui, nil, map[string]any{
+		"ConnType": string(kubectl),
+		"ID":       podName,
+	})
+}
+
+// determine and return kubectl global args for the kubeconfig, context, and namespace consistent with the testinfra backend
+func (postProcessor *PostProcessor) kubectlArgs() []string {
+	var args []string
+
+	params := map[string]string{
+		"kubeconfig": postProcessor.config.Kubeconfig,
+		"context":    postProcessor.config.KubectlContext,
+		"namespace":  postProcessor.config.KubectlNamespace,
+	}
+	for _, key := range []string{"kubeconfig", "context", "namespace"} {
+		// otherwise equivalent backend option
+		value := params[key]
+		if len(value) == 0 {
+			value = postProcessor.config.BackendOptions[key]
+		}
+		if len(value) > 0 {
+			args = append(args, fmt.Sprintf("--%s=%s", key, value))
+		}
+	}
+
+	return args
+}
@@ -0,0 +1,163 @@
+package testinfra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// duration to wait for qemu to shut down prior to killing it
+var qemuShutdownTimeout = 30 * time.Second
+
+// boot qemu disk image artifact with a snapshot overlay, and test it via ssh
+func (postProcessor *PostProcessor) testQemuImage(ctx context.Context, ui packer.Ui, artifact packer.Artifact) error {
+	// determine disk image and format
+	format, ok := artifact.State("diskType").(string)
+	if !ok || len(format) == 0 {
+		format = "qcow2"
+	}
+	diskName, _ := artifact.State("diskName").(string)
+	disk, err := qemuDiskImage(artifact.Files(), diskName, format)
+	if err != nil {
+		ui.Error("the disk image could not be determined from the artifact")
+		return err
+	}
+	if disk, err = filepath.Abs(disk); err != nil {
+		return err
+	}
+
+	// build communicator data for ssh credentials
+	buildData, ok := artifact.State("generated_data").(map[string]any)
+	if !ok {
+		ui.Error("the build communicator data could not be determined from the artifact")
+		return errors.New("unknown build data")
+	}
+
+	// local port forwarded to guest ssh
+	port, err := freePort()
+	if err != nil {
+		log.Print("unable to determine an available local port for ssh forwarding")
+		return err
+	}
+	guestPort := 22
+	if buildPort, ok := buildData["Port"].(int); ok && buildPort > 0 {
+		guestPort = buildPort
+	}
+
+	// boot with user mode networking and a snapshot overlay so the artifact is unmodified
+	qemuArgs := slices.Concat([]string{
+		"-machine", "accel=kvm:tcg",
+		"-m", strconv.Itoa(postProcessor.config.QemuMemory),
+		"-display", "none",
+		"-drive", fmt.Sprintf("file=%s,format=%s,if=virtio,snapshot=on", disk, format),
+		"-netdev", fmt.Sprintf("user,id=net0,hostfwd=tcp:127.0.0.1:%d-:%d", port, guestPort),
+		"-device", "virtio-net-pci,netdev=net0",
+	}, postProcessor.config.QemuArgs)
+	qemu := exec.Command(postProcessor.config.QemuBinary, qemuArgs...)
+	log.Printf("complete qemu command is: %s", qemu.String())
+
+	ui.Sayf("booting qemu disk image %s with ssh forwarded to local port %d", disk, port)
+	if err = qemu.Start(); err != nil {
+		ui.Errorf("qemu could not boot the disk image: %s", err)
+		return err
+	}
+
+	// shut down qemu upon completion, failure, or cancellation
+	defer shutdownQemu(qemu, ui)
+
+	// test booted image with the provisioner pipeline via the forwarded port
+	return postProcessor.provisioner.Provision(ctx, ui, nil, qemuGeneratedData(buildData, port))
+}
+
+// determine the disk image from the artifact files by the artifact disk name, or otherwise by the format extension, or otherwise the first file which is not uefi firmware (e.g. efivars.fd)
+func qemuDiskImage(files []string, diskName string, format string) (string, error) {
+	if len(diskName) > 0 {
+		for _, file := range files {
+			if file == diskName || filepath.Base(file) == filepath.Base(diskName) {
+				return file, nil
+			}
+		}
+		log.Printf("the artifact disk name does not match any artifact file, and the disk image will be determined from the format: %s", diskName)
+	}
+
+	var disk string
+	for _, file := range files {
+		extension := strings.TrimPrefix(filepath.Ext(file), ".")
+		if extension == format {
+			return file, nil
+		}
+		if len(disk) == 0 && extension != "fd" {
+			disk = file
+		}
+	}
+
+	if len(disk) == 0 {
+		return "", errors.New("unknown disk image")
+	}
+	return disk, nil
+}
+
+// return generated data for the booted image from the build communicator data
+func qemuGeneratedData(buildData map[string]any, port int) map[string]any {
+	generatedData := maps.Clone(buildData)
+	generatedData["ConnType"] = "ssh"
+	generatedData["Host"] = "127.0.0.1"
+	generatedData["SSHHost"] = "127.0.0.1"
+	generatedData["Port"] = port
+	generatedData["SSHPort"] = port
+
+	// private key files generated by packer are removed during build cleanup, so fallback to the private key content
+	if keyFile, ok := generatedData["SSHPrivateKeyFile"].(string); ok && len(keyFile) > 0 {
+		if _, err := os.Stat(keyFile); err != nil {
+			log.Printf("ssh private key file from the build no longer exists, and the ssh private key will be utilized instead: %s", keyFile)
+			delete(generatedData, "SSHPrivateKeyFile")
+		}
+	}
+
+	return generatedData
+}
+
+// terminate qemu, and kill it if it does not exit within the timeout
+func shutdownQemu(qemu *exec.Cmd, ui packer.Ui) {
+	ui.Say("shutting down qemu")
+
+	// writes are discarded with the snapshot overlay, so guest shutdown is unnecessary
+	exited := make(chan error, 1)
+	go func() { exited <- qemu.Wait() }()
+	if err := qemu.Process.Signal(os.Interrupt); err != nil {
+		log.Printf("unable to signal qemu to terminate: %s", err)
+	}
+
+	select {
+	case <-exited:
+	case <-time.After(qemuShutdownTimeout):
+		log.Print("qemu did not terminate within the timeout, and will be killed")
+		if err := qemu.Process.Kill(); err != nil {
+			ui.Errorf("unable to kill qemu process %d: %s", qemu.Process.Pid, err)
+		}
+		<-exited
+	}
+}
+
+// return an available local tcp port
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
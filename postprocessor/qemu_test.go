@@ -0,0 +1,116 @@
+package testinfra
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	testinfra "github.com/mschuchard/packer-plugin-testinfra/provisioner"
+)
+
+// test post-processor boots and tests qemu disk image artifacts
+func TestPostProcessorTestQemuImage(test *testing.T) {
+	ui := packer.TestUi(test)
+
+	// fake qemu which records its arguments and idles until terminated
+	qemuDir := test.TempDir()
+	script := "#!/bin/sh\necho \"$@\" > \"$(dirname \"$0\")/qemu.log\"\nexec sleep 60\n"
+	if err := os.WriteFile(filepath.Join(qemuDir, "qemu-system-x86_64"), []byte(script), 0o700); err != nil {
+		test.Fatal(err)
+	}
+	test.Setenv("PATH", qemuDir+":"+os.Getenv("PATH"))
+
+	// fake pytest which executes tests only after qemu has booted
+	pytest := filepath.Join(qemuDir, "py.test")
+	script = "#!/bin/sh\n[ \"$1\" = -h ] || while [ ! -s \"$(dirname \"$0\")/qemu.log\" ]; do sleep 0.1; done\necho \"testinfra\n--force-short-summary\"\n"
+	if err := os.WriteFile(pytest, []byte(script), 0o700); err != nil {
+		test.Fatal(err)
+	}
+
+	var postProcessor PostProcessor
+	if err := postProcessor.Configure(&Config{Config: testinfra.Config{PytestPath: pytest, ReadinessRetries: -1, SkipCollection: true}, QemuArgs: []string{"-smp", "2"}}); err != nil {
+		test.Fatalf("configure function failed: %s", err)
+	}
+
+	keyFile := filepath.Join(test.TempDir(), "id_ed25519")
+	os.WriteFile(keyFile, []byte("key"), 0o600)
+	artifact := &packer.MockArtifact{
+		BuilderIdValue: qemuBuilderID,
+		FilesValue:     []string{"/path/to/output/efivars.fd", "/path/to/output/packer-ubuntu"},
+		StateValues: map[string]any{
+			"diskType":       "raw",
+			"generated_data": map[string]any{"User": "me", "SSHUsername": "me", "SSHPrivateKeyFile": keyFile, "Port": 22},
+		},
+	}
+
+	if _, _, _, err := postProcessor.PostProcess(context.Background(), ui, artifact); err != nil {
+		test.Errorf("post-process function failed with qemu artifact: %s", err)
+	}
+
+	qemuLog, _ := os.ReadFile(filepath.Join(qemuDir, "qemu.log"))
+	if !strings.Contains(string(qemuLog), "-drive file=/path/to/output/packer-ubuntu,format=raw,if=virtio,snapshot=on") || !strings.Contains(string(qemuLog), "-:22 -device virtio-net-pci,netdev=net0 -smp 2") {
+		test.Errorf("qemu arguments incorrectly determined: %s", qemuLog)
+	}
+
+	// test missing build data
+	artifact.StateValues = map[string]any{}
+	if _, _, _, err := postProcessor.PostProcess(context.Background(), ui, artifact); err == nil || err.Error() != "unknown build data" {
+		test.Error("post-process function did not fail on missing build data")
+		test.Error(err)
+	}
+}
+
+// test qemuDiskImage properly determines the disk image from multiple artifact files
+func TestQemuDiskImage(test *testing.T) {
+	// test disk image matching the artifact disk name regardless of the extension
+	if disk, err := qemuDiskImage([]string{"output/efivars.fd", "output/packer-ubuntu.qcow2", "output/ubuntu.img"}, "ubuntu.img", "qcow2"); err != nil || disk != "output/ubuntu.img" {
+		test.Errorf("qemuDiskImage function failed to determine disk image by disk name: %s", disk)
+		test.Error(err)
+	}
+
+	// test unmatched artifact disk name falls back to the format extension
+	if disk, err := qemuDiskImage([]string{"output/efivars.fd", "output/packer-ubuntu.qcow2"}, "nonexistent", "qcow2"); err != nil || disk != "output/packer-ubuntu.qcow2" {
+		test.Errorf("qemuDiskImage function failed to fall back to the format extension: %s", disk)
+		test.Error(err)
+	}
+
+	// test disk image matching the format extension
+	if disk, err := qemuDiskImage([]string{"output/efivars.fd", "output/packer-ubuntu-1", "output/packer-ubuntu.qcow2"}, "", "qcow2"); err != nil || disk != "output/packer-ubuntu.qcow2" {
+		test.Errorf("qemuDiskImage function failed to determine disk image by format extension: %s", disk)
+		test.Error(err)
+	}
+
+	// test first disk image which is not firmware
+	if disk, err := qemuDiskImage([]string{"output/efivars.fd", "output/packer-ubuntu", "output/packer-ubuntu-1"}, "", "raw"); err != nil || disk != "output/packer-ubuntu" {
+		test.Errorf("qemuDiskImage function failed to determine disk image which is not firmware: %s", disk)
+		test.Error(err)
+	}
+
+	// test only firmware files
+	if _, err := qemuDiskImage([]string{"output/efivars.fd"}, "", "qcow2"); err == nil || err.Error() != "unknown disk image" {
+		test.Error("qemuDiskImage function did not fail with only firmware files")
+		test.Error(err)
+	}
+	if _, err := qemuDiskImage(nil, "", "qcow2"); err == nil {
+		test.Error("qemuDiskImage function did not fail without artifact files")
+	}
+}
+
+// test qemuGeneratedData properly determines generated data for the booted image
+func TestQemuGeneratedData(test *testing.T) {
+	buildData := map[string]any{"ConnType": "ssh", "SSHHost": "10.0.2.15", "SSHPort": 22, "SSHPrivateKeyFile": "/nonexistent/key", "SSHPrivateKey": "key"}
+
+	generatedData := qemuGeneratedData(buildData, 2222)
+	if generatedData["SSHHost"] != "127.0.0.1" || generatedData["SSHPort"] != 2222 || generatedData["SSHPrivateKey"] != "key" {
+		test.Errorf("generated data incorrectly determined: %v", generatedData)
+	}
+	if _, ok := generatedData["SSHPrivateKeyFile"]; ok {
+		test.Error("nonexistent ssh private key file was not removed from generated data")
+	}
+	if buildData["SSHHost"] != "10.0.2.15" {
+		test.Error("build data was modified")
+	}
+}
@@ -0,0 +1,207 @@
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+package testinfra
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+
+	testinfra "github.com/mschuchard/packer-plugin-testinfra/provisioner"
+)
+
+// config data deserialized/unmarshalled from packer template/config
+type Config struct {
+	testinfra.Config `mapstructure:",squash"`
+
+	QemuArgs   []string `mapstructure:"qemu_args" required:"false"`
+	QemuBinary string   `mapstructure:"qemu_binary" required:"false"`
+	QemuMemory int      `mapstructure:"qemu_memory" required:"false"`
+	RunArgs    []string `mapstructure:"run_args" required:"false"`
+	Runtime    string   `mapstructure:"runtime" required:"false"`
+
+	ctx interpolate.Context
+}
+
+// implements the packer.PostProcessor interface as testinfra.PostProcessor
+type PostProcessor struct {
+	config      Config
+	provisioner testinfra.Provisioner
+}
+
+// implements configspec with hcl2spec helper function
+func (postProcessor *PostProcessor) ConfigSpec() hcldec.ObjectSpec {
+	return postProcessor.config.FlatMapstructure().HCL2Spec()
+}
+
+// configures the post-processor plugin
+func (postProcessor *PostProcessor) Configure(raws ...any) error {
+	// parse testinfra post-processor config
+	err := config.Decode(&postProcessor.config, &config.DecodeOpts{
+		PluginType:         "testinfra",
+		Interpolate:        true,
+		InterpolateContext: &postProcessor.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			// hosts are rendered with packer generated data during testing
+			Exclude: []string{"hosts"},
+		},
+	}, raws...)
+	if err != nil {
+		log.Print("error decoding the supplied Packer config")
+		return err
+	}
+
+	// artifacts are tested remotely
+	if postProcessor.config.Local {
+		log.Print("local execution is unsupported with the post-processor because the build instance no longer exists")
+		return errors.New("local post-processor unsupported")
+	}
+
+	// runtime parameter
+	if len(postProcessor.config.Runtime) > 0 {
+		runtime, err := containerRuntime(postProcessor.config.Runtime).New()
+		if err != nil {
+			log.Printf("the runtime is not a supported container runtime: %s", postProcessor.config.Runtime)
+			return err
+		}
+		log.Printf("container images will be tested with the %s runtime", runtime)
+
+		// validate kubectl installation for launching pods
+		if runtime == kubectl {
+			if _, err := exec.LookPath("kubectl"); err != nil {
+				log.Print("kubectl is not installed or not found in the system PATH, and it is required to launch a pod with the kubectl runtime")
+				return err
+			}
+		}
+	}
+
+	// run args parameter
+	if len(postProcessor.config.RunArgs) > 0 {
+		log.Printf("additional container run arguments are: %s", strings.Join(postProcessor.config.RunArgs, " "))
+	}
+
+	// qemu parameters
+	if len(postProcessor.config.QemuBinary) == 0 {
+		log.Print("setting QemuBinary to default 'qemu-system-x86_64'")
+		postProcessor.config.QemuBinary = "qemu-system-x86_64"
+	}
+	if postProcessor.config.QemuMemory <= 0 {
+		log.Print("setting QemuMemory to default 1024 megabytes")
+		postProcessor.config.QemuMemory = 1024
+	}
+	if len(postProcessor.config.QemuArgs) > 0 {
+		log.Printf("additional qemu arguments are: %s", strings.Join(postProcessor.config.QemuArgs, " "))
+	}
+
+	// booted artifacts require readiness verification (negative value disables)
+	if postProcessor.config.ReadinessRetries == 0 {
+		log.Print("setting ReadinessRetries to post-processor default 10")
+		postProcessor.config.ReadinessRetries = 10
+	}
+
+	// validate testinfra config with the provisioner without decoding and interpolating it again
+	return postProcessor.provisioner.PrepareConfig(postProcessor.config.Config, postProcessor.config.ctx)
+}
+
+// tests the artifact with testinfra
+func (postProcessor *PostProcessor) PostProcess(ctx context.Context, ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, bool, error) {
+	ui.Sayf("testing %s artifact with Testinfra", artifact.BuilderId())
+
+	// determine artifact type
+	var err error
+	switch {
+	case slices.Contains(containerBuilderIDs, artifact.BuilderId()):
+		err = postProcessor.testContainerImage(ctx, ui, artifact)
+	case artifact.BuilderId() == qemuBuilderID:
+		err = postProcessor.testQemuImage(ctx, ui, artifact)
+	default:
+		ui.Errorf("the artifact from builder %s is unsupported by the testinfra post-processor", artifact.BuilderId())
+		err = errors.New("unsupported artifact")
+	}
+	if err != nil {
+		return artifact, true, false, err
+	}
+
+	ui.Say("packer plugin testinfra post-processing complete")
+
+	// artifact is unmodified
+	return artifact, true, false, nil
+}
+
+// test container image artifact within a throwaway container
+func (postProcessor *PostProcessor) testContainerImage(ctx context.Context, ui packer.Ui, artifact packer.Artifact) error {
+	// determine runtime
+	runtime := docker
+	if len(postProcessor.config.Runtime) > 0 {
+		runtime = containerRuntime(postProcessor.config.Runtime)
+	}
+
+	// image id or tag
+	image := artifact.Id()
+	if len(image) == 0 {
+		ui.Error("the container image could not be determined from the artifact")
+		return errors.New("unknown container image")
+	}
+
+	// launch pod from the image instead of a container
+	if runtime == kubectl {
+		return postProcessor.testKubectlPod(ctx, ui, image)
+	}
+
+	// start container which idles so that testinfra can execute within it
+	ui.Sayf("starting %s container from image %s", runtime, image)
+	runArgs := slices.Concat([]string{"run", "--detach"}, postProcessor.config.RunArgs, []string{"--entrypoint", "sleep", image, "infinity"})
+	output, err := postProcessor.runtimeCmd(ctx, runtime, runArgs...).Output()
+	if err != nil {
+		ui.Errorf("the %s container could not be started from image %s", runtime, image)
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			log.Printf("container runtime stderr: %s", exitErr.Stderr)
+		}
+		return err
+	}
+	containerID := strings.TrimSpace(string(output))
+	log.Printf("started %s container: %s", runtime, containerID)
+
+	// remove container upon completion, failure, or cancellation
+	defer func() {
+		if output, err := postProcessor.runtimeCmd(context.Background(), runtime, "rm", "--force", containerID).CombinedOutput(); err != nil {
+			ui.Errorf("the %s container %s could not be removed: %s", runtime, containerID, strings.TrimSpace(string(output)))
+		} else {
+			log.Printf("removed %s container: %s", runtime, containerID)
+		}
+	}()
+
+	// test container with the provisioner pipeline
+	return postProcessor.provisioner.Provision(ctx, ui, nil, map[string]any{
+		"ConnType": string(runtime),
+		"ID":       containerID,
+	})
+}
+
+// return container runtime command with the container daemon environment
+func (postProcessor *PostProcessor) runtimeCmd(ctx context.Context, runtime containerRuntime, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, string(runtime), args...)
+
+	// remote container daemon consistent with testinfra execution
+	cmd.Env = os.Environ()
+	if runtime == podman && len(postProcessor.config.PodmanConnection) > 0 {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("CONTAINER_CONNECTION=%s", postProcessor.config.PodmanConnection))
+	} else if len(postProcessor.config.ContainerHost) > 0 {
+		if runtime == docker {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("DOCKER_HOST=%s", postProcessor.config.ContainerHost))
+		} else {
+			cmd.Env = append(cmd.Env, fmt.Sprintf("CONTAINER_HOST=%s", postProcessor.config.ContainerHost))
+		}
+	}
+
+	return cmd
+}
@@ -0,0 +1,133 @@
+package testinfra
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	testinfra "github.com/mschuchard/packer-plugin-testinfra/provisioner"
+)
+
+// helper function to write a fake container runtime which records its arguments, and return its directory
+func fakeRuntime(test *testing.T, runtime containerRuntime) string {
+	runtimeDir := test.TempDir()
+	script := "#!/bin/sh\necho \"$@\" >> \"$(dirname \"$0\")/runtime.log\"\n[ \"$1\" = run ] && echo abcdef123456\nexit 0\n"
+	if err := os.WriteFile(filepath.Join(runtimeDir, string(runtime)), []byte(script), 0o700); err != nil {
+		test.Fatal(err)
+	}
+
+	return runtimeDir
+}
+
+// test post-processor config is validated
+func TestPostProcessorConfigure(test *testing.T) {
+	var postProcessor PostProcessor
+
+	if err := postProcessor.Configure(&Config{Config: testinfra.Config{PytestPath: "../fixtures/py.test", Local: true}}); err == nil || err.Error() != "local post-processor unsupported" {
+		test.Error("configure function did not fail on local execution")
+		test.Error(err)
+	}
+
+	if err := postProcessor.Configure(&Config{Config: testinfra.Config{PytestPath: "../fixtures/py.test"}, Runtime: "foo"}); err == nil || err.Error() != "invalid containerRuntime enum" {
+		test.Error("configure function did not fail on invalid runtime")
+		test.Error(err)
+	}
+
+	if err := postProcessor.Configure(&Config{Config: testinfra.Config{PytestPath: "../fixtures/py.test"}, Runtime: "podman", RunArgs: []string{"--privileged"}}); err != nil {
+		test.Errorf("configure function failed with valid config: %s", err)
+	}
+
+	// test config is decoded and interpolated only once
+	if err := postProcessor.Configure(map[string]any{"pytest_path": "../fixtures/py.test", "env_vars": map[string]string{"BRACES": `{{ "{{" }}`}}); err != nil {
+		test.Errorf("configure function interpolated the config more than once: %s", err)
+	}
+	if postProcessor.config.EnvVars["BRACES"] != "{{" {
+		test.Errorf("configure function incorrectly interpolated the config: %s", postProcessor.config.EnvVars["BRACES"])
+	}
+}
+
+// test post-processor tests container image artifacts within a throwaway container
+func TestPostProcessorPostProcess(test *testing.T) {
+	ui := packer.TestUi(test)
+	runtimeDir := fakeRuntime(test, podman)
+	test.Setenv("PATH", runtimeDir+":"+os.Getenv("PATH"))
+
+	var postProcessor PostProcessor
+	if err := postProcessor.Configure(&Config{Config: testinfra.Config{PytestPath: "../fixtures/py.test"}, Runtime: "podman", RunArgs: []string{"--privileged"}}); err != nil {
+		test.Fatalf("configure function failed: %s", err)
+	}
+
+	// test container image artifact
+	artifact := &packer.MockArtifact{BuilderIdValue: "packer.post-processor.docker-tag", IdValue: "myimage:latest"}
+	resultArtifact, keep, forceOverride, err := postProcessor.PostProcess(context.Background(), ui, artifact)
+	if err != nil {
+		test.Errorf("post-process function failed: %s", err)
+	}
+	if resultArtifact != artifact || !keep || forceOverride {
+		test.Error("post-process function modified the artifact or its retention")
+	}
+
+	runtimeLog, _ := os.ReadFile(filepath.Join(runtimeDir, "runtime.log"))
+	if commands := strings.Split(strings.TrimSpace(string(runtimeLog)), "\n"); len(commands) != 2 || commands[0] != "run --detach --privileged --entrypoint sleep myimage:latest infinity" || commands[1] != "rm --force abcdef123456" {
+		test.Errorf("container runtime commands incorrectly executed: %q", commands)
+	}
+
+	// test unsupported artifact
+	if _, _, _, err = postProcessor.PostProcess(context.Background(), ui, &packer.MockArtifact{BuilderIdValue: "foo"}); err == nil || err.Error() != "unsupported artifact" {
+		test.Error("post-process function did not fail on unsupported artifact")
+		test.Error(err)
+	}
+}
+
+// test post-processor tests container image artifacts within a throwaway kubectl pod
+func TestPostProcessorPostProcessKubectl(test *testing.T) {
+	ui := packer.TestUi(test)
+	kubectlDir := test.TempDir()
+	script := "#!/bin/sh\necho \"$@\" >> \"$(dirname \"$0\")/kubectl.log\"\ncase \"$*\" in *wait*) [ -z \"$KUBECTL_WAIT_FAIL\" ] ;; esac\n"
+	if err := os.WriteFile(filepath.Join(kubectlDir, "kubectl"), []byte(script), 0o700); err != nil {
+		test.Fatal(err)
+	}
+	test.Setenv("PATH", kubectlDir+":"+os.Getenv("PATH"))
+
+	// namespace from the backend options is consistent with testinfra
+	var postProcessor PostProcessor
+	if err := postProcessor.Configure(&Config{Config: testinfra.Config{PytestPath: "../fixtures/py.test", KubectlContext: "kind-packer", BackendOptions: map[string]string{"namespace": "test"}}, Runtime: "kubectl"}); err != nil {
+		test.Fatalf("configure function failed: %s", err)
+	}
+
+	artifact := &packer.MockArtifact{BuilderIdValue: "packer.post-processor.docker-push", IdValue: "registry.example.com/myimage:latest"}
+	if _, _, _, err := postProcessor.PostProcess(context.Background(), ui, artifact); err != nil {
+		test.Errorf("post-process function failed with kubectl runtime: %s", err)
+	}
+
+	kubectlLog, _ := os.ReadFile(filepath.Join(kubectlDir, "kubectl.log"))
+	commands := strings.Split(strings.TrimSpace(string(kubectlLog)), "\n")
+	if len(commands) != 3 {
+		test.Fatalf("kubectl commands incorrectly executed: %q", commands)
+	}
+	podName := strings.Fields(commands[0])[3]
+	expected := []string{
+		"--context=kind-packer --namespace=test run " + podName + " --image=registry.example.com/myimage:latest --restart=Never --command -- sleep infinity",
+		"--context=kind-packer --namespace=test wait --for=condition=Ready pod/" + podName + " --timeout=300s",
+		"--context=kind-packer --namespace=test delete pod " + podName + " --ignore-not-found --wait=false",
+	}
+	if !strings.HasPrefix(podName, "packer-testinfra-") || !slices.Equal(commands, expected) {
+		test.Errorf("kubectl commands incorrectly executed: %q", commands)
+	}
+
+	// test readiness failure still deletes pod
+	test.Setenv("KUBECTL_WAIT_FAIL", "true")
+	os.Remove(filepath.Join(kubectlDir, "kubectl.log"))
+	if _, _, _, err := postProcessor.PostProcess(context.Background(), ui, artifact); err == nil || err.Error() != "kubectl pod readiness failure" {
+		test.Error("post-process function did not fail on pod readiness failure")
+		test.Error(err)
+	}
+	kubectlLog, _ = os.ReadFile(filepath.Join(kubectlDir, "kubectl.log"))
+	if !strings.Contains(string(kubectlLog), "delete pod") {
+		test.Errorf("pod was not deleted after readiness failure: %s", kubectlLog)
+	}
+}
@@ -0,0 +1,38 @@
+package testinfra
+
+import (
+	"errors"
+	"log"
+	"slices"
+)
+
+// container runtime with pseudo-enum
+type containerRuntime string
+
+const (
+	docker  containerRuntime = "docker"
+	podman  containerRuntime = "podman"
+	kubectl containerRuntime = "kubectl"
+)
+
+var containerRuntimes = []containerRuntime{docker, podman, kubectl}
+
+// container runtime conversion
+func (a containerRuntime) New() (containerRuntime, error) {
+	if !slices.Contains(containerRuntimes, a) {
+		log.Printf("string %s could not be converted to containerRuntime enum", a)
+		return "", errors.New("invalid containerRuntime enum")
+	}
+	return a, nil
+}
+
+// builder ids of container image artifacts
+var containerBuilderIDs = []string{
+	"packer.docker",
+	"packer.post-processor.docker-import",
+	"packer.post-processor.docker-tag",
+	"packer.post-processor.docker-push",
+}
+
+// builder id of qemu disk image artifacts
+const qemuBuilderID = "transcend.qemu"
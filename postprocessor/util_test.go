@@ -0,0 +1,18 @@
+package testinfra
+
+import "testing"
+
+func TestContainerRuntimeNew(test *testing.T) {
+	runtimeTest, err := containerRuntime("podman").New()
+	if err != nil {
+		test.Errorf("containerRuntime conversion failed: %s", err)
+	}
+	if runtimeTest != podman {
+		test.Errorf("containerRuntime conversion returned unexpected value: %s", runtimeTest)
+	}
+
+	if _, err = containerRuntime("foo").New(); err == nil || err.Error() != "invalid containerRuntime enum" {
+		test.Error("containerRuntime conversion did not fail on invalid runtime")
+		test.Error(err)
+	}
+}
@@ -0,0 +1,98 @@
+package testinfra
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// pytest exit code when no tests were collected
+const pytestNoTestsCollected = 5
+
+// number of tests collected in pytest quiet collection output
+var collectedTests = regexp.MustCompile(`(\d+)(?:/\d+)? tests? collected`)
+
+// collect the tests selected by the config with pytest to validate the test suite, and return the number of collected tests
+func (provisioner *Provisioner) collectTests(config Config) (int, error) {
+	// collection with the configured selectors, and unregistered markers as errors
+	args := []string{"--collect-only", "-q", "--strict-markers"}
+	if len(config.ConfigFile) > 0 {
+		args = append(args, "-c", config.ConfigFile)
+	}
+	if len(config.RootDir) > 0 {
+		args = append(args, fmt.Sprintf("--rootdir=%s", config.RootDir))
+	}
+	if len(config.ConfCutDir) > 0 {
+		args = append(args, fmt.Sprintf("--confcutdir=%s", config.ConfCutDir))
+	}
+	args = append(args, provisioner.pluginArgs()...)
+	if len(config.Keyword) > 0 {
+		args = append(args, "-k", config.Keyword)
+	}
+	if len(config.Marker) > 0 {
+		args = append(args, "-m", config.Marker)
+	}
+	args = slices.Concat(args, config.TestFiles)
+
+	// relative pytest path would otherwise be evaluated within chdir
+	pytestPath := config.PytestPath
+	if strings.ContainsRune(pytestPath, filepath.Separator) {
+		absPath, err := filepath.Abs(pytestPath)
+		if err != nil {
+			return 0, err
+		}
+		pytestPath = absPath
+	}
+
+	// execute collection in the same directory and environment as the tests
+	cmd := exec.Command(pytestPath, args...)
+	cmd.Dir = config.Chdir
+	cmd.Env = os.Environ()
+	for _, key := range slices.Sorted(maps.Keys(config.EnvVars)) {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, config.EnvVars[key]))
+	}
+	if config.DisablePluginAutoload {
+		cmd.Env = append(cmd.Env, "PYTEST_DISABLE_PLUGIN_AUTOLOAD=1")
+	}
+	log.Printf("Pytest collection command is: %s", cmd.String())
+
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == pytestNoTestsCollected {
+			log.Printf("pytest collected no tests: %s", output)
+			return 0, errNoTestsCollected
+		}
+
+		// syntax errors, import errors, unknown markers, etc.
+		log.Printf("pytest test collection failed: %s", output)
+		if errors.As(err, &exitErr) {
+			log.Print(string(exitErr.Stderr))
+		}
+		return 0, errors.New("test collection failure")
+	}
+
+	// determine number of collected tests
+	match := collectedTests.FindSubmatch(output)
+	if match == nil {
+		log.Printf("unable to determine number of collected tests from pytest output: %s", output)
+		return 0, errors.New("test collection failure")
+	}
+	count, err := strconv.Atoi(string(match[1]))
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, errNoTestsCollected
+	}
+
+	return count, nil
+}
@@ -0,0 +1,27 @@
+package testinfra
+
+import "testing"
+
+// test provisioner collectTests properly collects tests with pytest
+func TestProvisionerCollectTests(test *testing.T) {
+	provisioner := &Provisioner{}
+
+	config := Config{PytestPath: "../fixtures/py.test", Chdir: "/tmp", TestFiles: []string{"../fixtures/test.py"}}
+	if count, err := provisioner.collectTests(config); err != nil || count != 1 {
+		test.Errorf("collectTests failed to collect tests: %d, %v", count, err)
+	}
+
+	// test empty selection
+	config.Marker = "nonexistent"
+	if _, err := provisioner.collectTests(config); err == nil || err.Error() != "no tests collected" {
+		test.Error("collectTests did not fail on empty selection")
+		test.Error(err)
+	}
+
+	// test collection errors
+	config.PytestPath = "false"
+	if _, err := provisioner.collectTests(config); err == nil || err.Error() != "test collection failure" {
+		test.Error("collectTests did not fail on collection error")
+		test.Error(err)
+	}
+}
@@ -7,17 +7,21 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
 	"slices"
 	"strings"
+	"sync"
 
 	"github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
 )
 
 // execute testinfra remotely with *exec.Cmd
-func execCmd(cmd *exec.Cmd, ui packer.Ui) error {
+func execCmd(cmd *exec.Cmd, noTests noTestsPolicy, ui packer.Ui) error {
 	// prepare stdout and stderr pipes
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -47,7 +51,7 @@ func execCmd(cmd *exec.Cmd, ui packer.Ui) error {
 		return err
 	}
 	if len(outSlurp) > 0 {
-		ui.Say("Testinfra results include the following:")
+		ui.Sayf("Testinfra results for %s include the following:", displayHosts(cmd.Args))
 		ui.Say(string(outSlurp))
 	} else {
 		ui.Say("Testinfra produced no stdout; it is probable that something unintended occurred during execution")
@@ -61,9 +65,25 @@ func execCmd(cmd *exec.Cmd, ui packer.Ui) error {
 
 	// wait for testinfra to complete and flush buffers
 	if err = cmd.Wait(); err != nil {
-		ui.Error("Testinfra returned non-zero exit status")
-		ui.Error(string(errSlurp))
-		return err
+		// interpret pytest exit code
+		var exitErr *exec.ExitError
+		var description string
+		if errors.As(err, &exitErr) {
+			if exitDescription, exitCodeErr := pytestExitError(exitErr.ExitCode()); exitCodeErr != nil {
+				description, err = exitDescription, exitCodeErr
+			}
+		}
+
+		if errors.Is(err, errNoTestsCollected) && noTests == warn {
+			ui.Sayf("Warning: Testinfra collected no tests for %s; %s", displayHosts(cmd.Args), description)
+		} else {
+			ui.Error("Testinfra returned non-zero exit status")
+			if len(description) > 0 {
+				ui.Error(description)
+			}
+			ui.Error(string(errSlurp))
+			return err
+		}
 	}
 
 	// finish and return
@@ -72,8 +92,40 @@ func execCmd(cmd *exec.Cmd, ui packer.Ui) error {
 	return nil
 }
 
+// execute testinfra remotely with *exec.Cmd for multiple hosts in parallel
+func execCmdsParallel(cmds []*exec.Cmd, noTests noTestsPolicy, ui packer.Ui) error {
+	// initialize wait group, per host errors, and lock for displaying output
+	var waitGroup sync.WaitGroup
+	var uiLock sync.Mutex
+	errs := make([]error, len(cmds))
+
+	// execute each host command concurrently
+	for index, cmd := range cmds {
+		waitGroup.Go(func() {
+			// buffer host output so it is displayed together instead of interleaved with other hosts
+			var output bytes.Buffer
+			hostUi := &packer.BasicUi{Reader: strings.NewReader(""), Writer: &output, ErrorWriter: &output}
+			err := execCmd(cmd, noTests, hostUi)
+
+			uiLock.Lock()
+			defer uiLock.Unlock()
+			if err != nil {
+				ui.Error(strings.TrimSuffix(output.String(), "\n"))
+				ui.Errorf("Testinfra validation failed for %s", displayHosts(cmd.Args))
+				errs[index] = err
+			} else {
+				ui.Say(strings.TrimSuffix(output.String(), "\n"))
+			}
+		})
+	}
+	waitGroup.Wait()
+
+	// return collection of errors
+	return errors.Join(errs...)
+}
+
 // execute testinfra local to temp packer instance with packer.RemoteCmd
-func packerRemoteCmd(ctx context.Context, localCmd *packer.RemoteCmd, installCmd []string, comm packer.Communicator, ui packer.Ui) error {
+func packerRemoteCmd(ctx context.Context, localCmd *packer.RemoteCmd, installCmd []string, noTests noTestsPolicy, comm packer.Communicator, ui packer.Ui) error {
 	// install testinfra on temp packer instance
 	if len(installCmd) > 0 {
 		// cast installCmd to string, log, and init localInstallCmd
@@ -104,10 +156,20 @@ func packerRemoteCmd(ctx context.Context, localCmd *packer.RemoteCmd, installCmd
 	// wait for testinfra to complete and flush buffers
 	// then check for pytest/testinfra execution issues
 	if exitStatus := localCmd.Wait(); exitStatus > 0 {
-		ui.Error("Testinfra errored internally during execution:")
-		ui.Error(stderr.String())
-		ui.Errorf("Testinfra returned exit status: %d", exitStatus)
-		return errors.New("testinfra non-zero exit code")
+		// interpret pytest exit code
+		description, err := pytestExitError(exitStatus)
+		if errors.Is(err, errNoTestsCollected) && noTests == warn {
+			ui.Sayf("Warning: Testinfra collected no tests; %s", description)
+		} else {
+			ui.Error("Testinfra errored internally during execution:")
+			ui.Error(stderr.String())
+			ui.Errorf("Testinfra returned exit status: %d", exitStatus)
+			if err == nil {
+				return errors.New("testinfra non-zero exit code")
+			}
+			ui.Error(description)
+			return err
+		}
 	}
 
 	// capture and display testinfra output
@@ -124,21 +186,65 @@ func packerRemoteCmd(ctx context.Context, localCmd *packer.RemoteCmd, installCmd
 	return nil
 }
 
-// determine and return execution command for testinfra
-func (provisioner *Provisioner) determineExecCmd(ctx context.Context, ui packer.Ui) (*exec.Cmd, *packer.RemoteCmd, error) {
-	// declare args
+// determine pytest plugin arguments from the plugin parameters
+func (provisioner *Provisioner) pluginArgs() []string {
+	var args []string
+
+	// explicitly load required plugins when autoloading is disabled
+	if provisioner.config.DisablePluginAutoload {
+		args = append(args, "-p", "testinfra.plugin")
+		if provisioner.config.Parallel {
+			args = append(args, "-p", "xdist.plugin")
+		}
+	}
+	// enabled and disabled plugins
+	for _, plugin := range provisioner.config.PluginsEnable {
+		args = append(args, "-p", plugin)
+	}
+	for _, plugin := range provisioner.config.PluginsDisable {
+		args = append(args, "-p", fmt.Sprintf("no:%s", plugin))
+	}
+
+	return args
+}
+
+// determine the environment variables set for remote execution in addition to the os environment
+func (provisioner *Provisioner) envAdditions() []string {
+	// intiialize envVars string slice
+	envVars := make([]string, 0, len(provisioner.commEnv)+len(provisioner.config.EnvVars)+1)
+
+	// convert environment determined from communication, and then env vars parameter, from map to slice
+	for _, env := range []map[string]string{provisioner.commEnv, provisioner.config.EnvVars} {
+		for _, key := range slices.Sorted(maps.Keys(env)) {
+			envVars = append(envVars, fmt.Sprintf("%s=%s", key, env[key]))
+		}
+	}
+	// disable plugin autoload
+	if provisioner.config.DisablePluginAutoload {
+		envVars = append(envVars, "PYTEST_DISABLE_PLUGIN_AUTOLOAD=1")
+	}
+
+	return envVars
+}
+
+// determine and return execution command(s) for testinfra
+func (provisioner *Provisioner) determineExecCmd(ctx context.Context, ui packer.Ui) ([]*exec.Cmd, *packer.RemoteCmd, error) {
+	// declare args and communication targets
 	var args []string
+	var targets [][]string
 
-	// assign determined communication string
+	// assign determined communication strings
 	localExec := provisioner.config.Local
 	if !localExec {
-		communication, err := provisioner.determineCommunication(ui)
+		// reset environment determined from communication
+		provisioner.commEnv = nil
+
+		var err error
+		targets, err = provisioner.determineTargets(ui)
 		if err != nil {
 			ui.Error("could not accurately determine packer communication configuration")
 			return nil, nil, err
 		}
-
-		args = slices.Concat(args, communication)
 	}
 
 	// assign mandatory populated values
@@ -150,6 +256,24 @@ func (provisioner *Provisioner) determineExecCmd(ctx context.Context, ui packer.
 	}
 
 	// assign optional populated values
+	// config file
+	configFile := provisioner.config.ConfigFile
+	if localExec && len(configFile) > 0 {
+		// config file is transferred to the destination directory on the instance
+		configFile = path.Join(provisioner.config.DestinationDir, filepath.Base(configFile))
+	}
+	if len(configFile) > 0 {
+		args = append(args, "-c", configFile)
+	}
+	// rootdir and confcutdir (instance paths with local execution)
+	if len(provisioner.config.RootDir) > 0 {
+		args = append(args, fmt.Sprintf("--rootdir=%s", provisioner.config.RootDir))
+	}
+	if len(provisioner.config.ConfCutDir) > 0 {
+		args = append(args, fmt.Sprintf("--confcutdir=%s", provisioner.config.ConfCutDir))
+	}
+	// plugins
+	args = append(args, provisioner.pluginArgs()...)
 	// compact
 	if provisioner.config.Compact {
 		args = append(args, "--no-header", "--no-summary", "--disable-warnings", "--force-short-summary")
@@ -194,38 +318,43 @@ func (provisioner *Provisioner) determineExecCmd(ctx context.Context, ui packer.
 	}
 
 	// testfiles
-	args = slices.Concat(args, provisioner.config.TestFiles)
+	if localExec && len(provisioner.config.DestinationDir) > 0 {
+		// test files (or test source) are transferred to the destination directory on the instance
+		for _, testFile := range provisioner.config.TestFiles {
+			args = append(args, path.Join(provisioner.config.DestinationDir, relativePath(testFile, provisioner.testFileRoots)))
+		}
+	} else {
+		args = slices.Concat(args, provisioner.config.TestFiles)
+	}
 
 	// return packer remote command for local testing on instance
 	if localExec {
 		// prepend pytest path to args for command string slice
 		command := slices.Insert(args, 0, pytestPath)
-		return nil, &packer.RemoteCmd{Command: strings.Join(command, " ")}, nil
-	} else { // return exec command for remote testing against instance
-		// initialize cmd
-		cmd := exec.CommandContext(ctx, pytestPath, args...)
-		// determine if user requested execution in different directory
-		if len(provisioner.config.Chdir) > 0 {
-			cmd.Dir = provisioner.config.Chdir
+		// environment variables are otherwise unsupported with local execution
+		if provisioner.config.DisablePluginAutoload {
+			command = slices.Insert(command, 0, "PYTEST_DISABLE_PLUGIN_AUTOLOAD=1")
 		}
+		return nil, &packer.RemoteCmd{Command: strings.Join(command, " ")}, nil
+	} else { // return exec command per target for remote testing against instance
+		// determine environment variables in addition to the os environment
+		envVars := provisioner.envAdditions()
 
-		// convert env vars parameter from map to slice
-		if len(provisioner.config.EnvVars) > 0 {
-			// intiialize envVars string slice
-			envVars := make([]string, 0, len(provisioner.config.EnvVars))
-
-			// convert EnvVars map to envVars slice
-			for key, value := range provisioner.config.EnvVars {
-				envVars = append(envVars, fmt.Sprintf("%s=%s", key, value))
+		cmds := make([]*exec.Cmd, 0, len(targets))
+		for _, communication := range targets {
+			// initialize cmd with communication args preceding others
+			cmd := exec.CommandContext(ctx, pytestPath, slices.Concat(communication, args)...)
+			// determine if user requested execution in different directory
+			if len(provisioner.config.Chdir) > 0 {
+				cmd.Dir = provisioner.config.Chdir
 			}
 
 			// concat os environment with envVars
 			cmd.Env = slices.Concat(os.Environ(), envVars)
-		} else {
-			// initialize environment variables from os
-			cmd.Env = os.Environ()
+
+			cmds = append(cmds, cmd)
 		}
 
-		return cmd, nil, nil
+		return cmds, nil, nil
 	}
 }
@@ -1,9 +1,13 @@
 package testinfra
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"os/exec"
 	"slices"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/packer-plugin-sdk/packer"
@@ -23,18 +27,65 @@ func TestProvisionerDetermineExecCmd(test *testing.T) {
 		},
 	}
 
-	execCmd, localCmd, err := provisioner.determineExecCmd(context.Background(), ui)
+	execCmds, localCmd, err := provisioner.determineExecCmd(context.Background(), ui)
 	if err != nil {
 		test.Errorf("determineExecCmd function failed to determine execution commands for local execution minimal config: %v", err)
 	}
-	if execCmd != nil {
-		test.Errorf("determineExecCmd function failed to properly determine remote execution command for local execution minimal config: %s", execCmd.String())
+	if len(execCmds) > 0 {
+		test.Errorf("determineExecCmd function failed to properly determine remote execution command for local execution minimal config: %v", execCmds)
 	}
 	if localCmd.Command != provisioner.config.PytestPath {
 		test.Errorf("determineExecCmd function failed to properly determine local execution command for local execution minimal config: %s", localCmd.Command)
 		test.Error(provisioner.config.PytestPath)
 	}
 
+	// test config file and rootdir with local execution
+	provisioner.config.DestinationDir = "/tmp/tests"
+	provisioner.config.ConfigFile = "../fixtures/pytest.ini"
+	provisioner.config.RootDir = "/opt/tests"
+	provisioner.config.ConfCutDir = "/opt/tests/unit"
+
+	_, localCmd, err = provisioner.determineExecCmd(context.Background(), ui)
+	if err != nil {
+		test.Errorf("determineExecCmd function failed to determine execution command for local execution with config file: %v", err)
+	}
+	if localCmd.Command != "/usr/local/bin/py.test -c /tmp/tests/pytest.ini --rootdir=/opt/tests --confcutdir=/opt/tests/unit" {
+		test.Errorf("determineExecCmd function failed to properly determine local execution command with config file: %s", localCmd.Command)
+	}
+
+	// test test files transferred to destination directory with local execution
+	provisioner.config.ConfigFile = ""
+	provisioner.config.RootDir = ""
+	provisioner.config.ConfCutDir = ""
+	provisioner.config.TestFiles = []string{"../fixtures/test.py", "../fixtures/nested/test_c.py"}
+	provisioner.testFileRoots = map[string]string{"../fixtures/nested/test_c.py": "../fixtures"}
+
+	_, localCmd, err = provisioner.determineExecCmd(context.Background(), ui)
+	if err != nil {
+		test.Errorf("determineExecCmd function failed to determine execution command for local execution with test files: %v", err)
+	}
+	if localCmd.Command != "/usr/local/bin/py.test /tmp/tests/test.py /tmp/tests/nested/test_c.py" {
+		test.Errorf("determineExecCmd function failed to properly determine local execution command with transferred test files: %s", localCmd.Command)
+	}
+	provisioner.config.TestFiles = nil
+	provisioner.testFileRoots = nil
+	provisioner.config.DestinationDir = ""
+
+	// test plugins with local execution
+	provisioner.config.ConfigFile = ""
+	provisioner.config.RootDir = ""
+	provisioner.config.PluginsEnable = []string{"pytest_html"}
+	provisioner.config.PluginsDisable = []string{"cacheprovider"}
+	provisioner.config.DisablePluginAutoload = true
+
+	_, localCmd, err = provisioner.determineExecCmd(context.Background(), ui)
+	if err != nil {
+		test.Errorf("determineExecCmd function failed to determine execution command for local execution with plugins: %v", err)
+	}
+	if localCmd.Command != "PYTEST_DISABLE_PLUGIN_AUTOLOAD=1 /usr/local/bin/py.test -p testinfra.plugin -p pytest_html -p no:cacheprovider" {
+		test.Errorf("determineExecCmd function failed to properly determine local execution command with plugins: %s", localCmd.Command)
+	}
+
 	// test basic config with ssh generated data
 	provisioner = &Provisioner{
 		config: *basicConfig,
@@ -51,15 +102,19 @@ func TestProvisionerDetermineExecCmd(test *testing.T) {
 		"ID":                "1234567890",
 	}
 
-	execCmd, localCmd, err = provisioner.determineExecCmd(context.Background(), ui)
+	execCmds, localCmd, err = provisioner.determineExecCmd(context.Background(), ui)
 	if err != nil {
 		test.Errorf("determineExecCmd function failed to determine execution command for basic config with SSH communicator: %s", err)
 	}
+	if len(execCmds) != 1 {
+		test.Fatalf("determineExecCmd function failed to determine exactly one execution command for basic config with SSH communicator: %v", execCmds)
+	}
+	execCmd := execCmds[0]
 	if execCmd.Dir != basicConfig.Chdir {
 		test.Error("determineExecCmd function failed to determine execution directory for basic config")
 		test.Errorf("actual: %s, expected: %s", execCmd.Dir, basicConfig.Chdir)
 	}
-	if !slices.Equal(execCmd.Args, slices.Concat([]string{provisioner.config.PytestPath, fmt.Sprintf("--hosts=ssh://%s@%s:%d", provisioner.generatedData["User"], provisioner.generatedData["Host"], provisioner.generatedData["Port"]), fmt.Sprintf("--ssh-identity-file=%s", provisioner.generatedData["SSHPrivateKeyFile"]), "--ssh-extra-args=\"-o StrictHostKeyChecking=no\"", "--no-header", "--no-summary", "--disable-warnings", "--force-short-summary", "-k", provisioner.config.Keyword, "-m", provisioner.config.Marker, "-n", "auto", "--sudo", "-vv"}, provisioner.config.TestFiles)) {
+	if !slices.Equal(execCmd.Args, slices.Concat([]string{provisioner.config.PytestPath, fmt.Sprintf("--hosts=ssh://%s@%s:%d", provisioner.generatedData["User"], provisioner.generatedData["Host"], provisioner.generatedData["Port"]), fmt.Sprintf("--ssh-identity-file=%s", provisioner.generatedData["SSHPrivateKeyFile"]), "--ssh-extra-args='-o StrictHostKeyChecking=no'", "--no-header", "--no-summary", "--disable-warnings", "--force-short-summary", "-k", provisioner.config.Keyword, "-m", provisioner.config.Marker, "-n", "auto", "--sudo", "-vv"}, provisioner.config.TestFiles)) {
 		test.Errorf("determineExecCmd function failed to properly determine remote execution command for basic config with SSH communicator: %s", execCmd.String())
 	}
 	if localCmd != nil {
@@ -69,4 +124,132 @@ func TestProvisionerDetermineExecCmd(test *testing.T) {
 	if !slices.Contains(execCmd.Env, "foo=bar") || !slices.Contains(execCmd.Env, "baz=bot") {
 		test.Errorf("determineExecCmd function failed to properly determine remote execution command environment variables for basic config with SSH communicator: %v", execCmd.Env)
 	}
+
+	// test hosts override replaces communication
+	provisioner = &Provisioner{
+		config: Config{
+			PytestPath: "py.test",
+			Hosts:      []string{"ssh://{{ .User }}@{{ .Host }}", "docker://sidecar"},
+		},
+	}
+	provisioner.generatedData = map[string]any{
+		"ConnType": "ssh",
+		"User":     "me",
+		"Host":     "192.168.0.1",
+	}
+	provisioner.config.ctx.Data = provisioner.generatedData
+
+	execCmds, _, err = provisioner.determineExecCmd(context.Background(), ui)
+	if err != nil {
+		test.Errorf("determineExecCmd function failed to determine execution command for hosts override: %s", err)
+	}
+	if len(execCmds) != 1 || !slices.Equal(execCmds[0].Args, []string{"py.test", "--hosts=ssh://me@192.168.0.1,docker://sidecar"}) {
+		test.Errorf("determineExecCmd function failed to properly determine remote execution command for hosts override: %v", execCmds)
+	}
+
+	// test hosts override in parallel with packer communicator and extra args
+	provisioner.config.Hosts = []string{"packer", "docker://sidecar"}
+	provisioner.config.HostsParallel = true
+	provisioner.config.Marker = "fast"
+	provisioner.generatedData["SSHAgentAuth"] = true
+	provisioner.generatedData["Port"] = 22
+
+	execCmds, _, err = provisioner.determineExecCmd(context.Background(), ui)
+	if err != nil {
+		test.Errorf("determineExecCmd function failed to determine execution commands for parallel hosts: %s", err)
+	}
+	if len(execCmds) != 2 || !slices.Equal(execCmds[0].Args, []string{"py.test", "--hosts=ssh://me@192.168.0.1:22", "--ssh-extra-args='-o StrictHostKeyChecking=no'", "-m", "fast"}) || !slices.Equal(execCmds[1].Args, []string{"py.test", "--hosts=docker://sidecar", "-m", "fast"}) {
+		test.Errorf("determineExecCmd function failed to properly determine remote execution commands for parallel hosts: %v", execCmds)
+	}
+}
+
+// test execCmdsParallel executes every command and collects failures
+func TestExecCmdsParallel(test *testing.T) {
+	ui := packer.TestUi(test)
+
+	// test all successful executions
+	if err := execCmdsParallel([]*exec.Cmd{exec.Command("../fixtures/py.test", "--hosts=docker://one"), exec.Command("../fixtures/py.test", "--hosts=docker://two")}, fail, ui); err != nil {
+		test.Errorf("execCmdsParallel function failed with successful commands: %s", err)
+	}
+
+	// test one failed execution
+	if err := execCmdsParallel([]*exec.Cmd{exec.Command("../fixtures/py.test", "--hosts=docker://one"), exec.Command("false", "--hosts=docker://two")}, fail, ui); err == nil {
+		test.Error("execCmdsParallel function did not fail with one failed command")
+	}
+
+	// test output of each host is displayed together
+	var output bytes.Buffer
+	bufferUi := &packer.BasicUi{Reader: strings.NewReader(""), Writer: &output, ErrorWriter: &output}
+	if err := execCmdsParallel([]*exec.Cmd{exec.Command("sh", "-c", "echo one", "--hosts=docker://one"), exec.Command("sh", "-c", "sleep 0.2; echo two", "--hosts=docker://two")}, fail, bufferUi); err != nil {
+		test.Errorf("execCmdsParallel function failed with successful commands: %s", err)
+	}
+	if display := output.String(); !strings.HasPrefix(display, "Beginning Testinfra validation of machine image\nTestinfra results for docker://one include the following:\none\n\nTestinfra machine image testing is complete\nBeginning") {
+		test.Errorf("execCmdsParallel function interleaved the output of each host: %s", display)
+	}
+}
+
+// test execCmd interprets pytest exit codes
+func TestExecCmdExitCodes(test *testing.T) {
+	ui := packer.TestUi(test)
+
+	// test failed tests
+	if err := execCmd(exec.Command("sh", "-c", "echo failed; exit 1"), fail, ui); !errors.Is(err, errTestsFailed) {
+		test.Errorf("execCmd function did not return tests failed error: %v", err)
+	}
+
+	// test no tests collected as error and warning
+	if err := execCmd(exec.Command("sh", "-c", "echo collected 0 items; exit 5"), fail, ui); !errors.Is(err, errNoTestsCollected) {
+		test.Errorf("execCmd function did not return no tests collected error: %v", err)
+	}
+	if err := execCmd(exec.Command("sh", "-c", "echo collected 0 items; exit 5"), warn, ui); err != nil {
+		test.Errorf("execCmd function failed with no tests collected as warning: %s", err)
+	}
+
+	// test unknown exit code
+	if err := execCmd(exec.Command("sh", "-c", "echo unknown; exit 127"), warn, ui); err == nil || errors.Is(err, errNoTestsCollected) {
+		test.Errorf("execCmd function did not return exit error for unknown exit code: %v", err)
+	}
+}
+
+// test packerRemoteCmd interprets pytest exit codes
+func TestPackerRemoteCmdExitCodes(test *testing.T) {
+	ui := packer.TestUi(test)
+
+	comm := &packer.MockCommunicator{StartExitStatus: 4}
+	if err := packerRemoteCmd(context.Background(), &packer.RemoteCmd{Command: "py.test"}, nil, fail, comm, ui); !errors.Is(err, errUsageError) {
+		test.Errorf("packerRemoteCmd function did not return usage error: %v", err)
+	}
+
+	comm.StartExitStatus = 5
+	if err := packerRemoteCmd(context.Background(), &packer.RemoteCmd{Command: "py.test"}, nil, warn, comm, ui); err != nil {
+		test.Errorf("packerRemoteCmd function failed with no tests collected as warning: %s", err)
+	}
+	if err := packerRemoteCmd(context.Background(), &packer.RemoteCmd{Command: "py.test"}, nil, fail, comm, ui); !errors.Is(err, errNoTestsCollected) {
+		test.Errorf("packerRemoteCmd function did not return no tests collected error: %v", err)
+	}
+
+	comm.StartExitStatus = 255
+	if err := packerRemoteCmd(context.Background(), &packer.RemoteCmd{Command: "py.test"}, nil, fail, comm, ui); err == nil || err.Error() != "testinfra non-zero exit code" {
+		test.Errorf("packerRemoteCmd function did not return generic error for unknown exit code: %v", err)
+	}
+}
+
+// test pluginArgs properly determines pytest plugin arguments
+func TestProvisionerPluginArgs(test *testing.T) {
+	provisioner := &Provisioner{
+		config: Config{
+			DisablePluginAutoload: true,
+			Parallel:              true,
+			PluginsDisable:        []string{"randomly"},
+		},
+	}
+
+	if args := provisioner.pluginArgs(); !slices.Equal(args, []string{"-p", "testinfra.plugin", "-p", "xdist.plugin", "-p", "no:randomly"}) {
+		test.Errorf("pluginArgs function failed to properly determine plugin arguments: %v", args)
+	}
+
+	provisioner.config = Config{}
+	if args := provisioner.pluginArgs(); len(args) > 0 {
+		test.Errorf("pluginArgs function determined plugin arguments without plugin parameters: %v", args)
+	}
 }
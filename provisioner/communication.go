@@ -4,13 +4,19 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/packer-plugin-sdk/packer"
-	"github.com/hashicorp/packer-plugin-sdk/tmp"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	gossh "golang.org/x/crypto/ssh"
+	sshagent "golang.org/x/crypto/ssh/agent"
 )
 
 // determine and return appropriate communication string for pytest/testinfra
@@ -18,16 +24,9 @@ func (provisioner *Provisioner) determineCommunication(ui packer.Ui) ([]string,
 	// declare communication args
 	var args []string
 
-	// determine communication type string by packer data
-	connectionString, ok := provisioner.generatedData["ConnType"].(string)
-	if !ok || len(connectionString) == 0 {
-		ui.Error("packer is unable to determine the communicator connection type from available data")
-		return nil, errors.New("unknown communicator connection type")
-	}
-	// convert to enum
-	connectionType, err := connectionType(connectionString).New()
+	// determine connection type
+	connectionType, err := provisioner.determineConnectionType(ui)
 	if err != nil {
-		ui.Error("packer is using an unsupported connection type")
 		return nil, err
 	}
 
@@ -35,9 +34,9 @@ func (provisioner *Provisioner) determineCommunication(ui packer.Ui) ([]string,
 
 	// determine communication based on connection type
 	switch connectionType {
-	case ssh:
+	case ssh, paramiko:
 		// assign user and host address
-		user, httpAddr, err := provisioner.determineUserAddr(connectionType, ui)
+		user, httpAddr, err := provisioner.determineUserAddr(ssh, ui)
 		if err != nil {
 			return nil, err
 		}
@@ -69,31 +68,86 @@ func (provisioner *Provisioner) determineCommunication(ui packer.Ui) ([]string,
 			ui.Say("utilizing SSH private key for communicator authentication")
 			log.Printf("SSH private key filesystem location is: %s", sshAuthString)
 
-			// append args with ssh connection backend information (user, host, port), private key file, and no strict host key checking
-			args = append(args, fmt.Sprintf("--hosts=ssh://%s@%s", user, httpAddr), fmt.Sprintf("--ssh-identity-file=%s", sshAuthString), "--ssh-extra-args=\"-o StrictHostKeyChecking=no\"")
+			// append args with ssh connection backend information (user, host, port), and private key file
+			args = append(args, fmt.Sprintf("--hosts=%s://%s@%s", connectionType, user, httpAddr), fmt.Sprintf("--ssh-identity-file=%s", sshAuthString))
 		// use ssh password
 		case password:
 			ui.Say("utilizing SSH password for communicator authentication")
-			// validate sshpass is installed
-			if _, err := exec.LookPath("sshpass"); err != nil {
-				ui.Error("sshpass is not installed or not found in the system path, and it is required to support password-based SSH authentication in testinfra")
-				return nil, errors.New("sshpass installation not found")
+			// validate sshpass is installed (paramiko natively supports passwords)
+			if connectionType == ssh {
+				if _, err := exec.LookPath("sshpass"); err != nil {
+					ui.Error("sshpass is not installed or not found in the system path, and it is required to support password-based SSH authentication in testinfra")
+					return nil, errors.New("sshpass installation not found")
+				}
 			}
 
-			// append args with ssh connection backend information (user, password, host, port), and no strict host key checking
-			args = append(args, fmt.Sprintf("--hosts=ssh://%s:%s@%s", user, sshAuthString, httpAddr), "--ssh-extra-args=\"-o StrictHostKeyChecking=no\"")
+			// append args with ssh connection backend information (user, password, host, port)
+			args = append(args, fmt.Sprintf("--hosts=%s://%s:%s@%s", connectionType, user, sshAuthString, httpAddr))
 		// use ssh agent auth
 		case agent:
 			ui.Say("utilizing SSH Agent for communicator authentication")
 
-			// append args with ssh connection backend information (user, host, port), and no strict host key checking
-			args = append(args, fmt.Sprintf("--hosts=ssh://%s@%s", user, httpAddr), "--ssh-extra-args=\"-o StrictHostKeyChecking=no\"")
+			// specific agent socket instead of ambient agent
+			if len(sshAuthString) > 0 {
+				log.Printf("SSH Agent socket location is: %s", sshAuthString)
+				provisioner.setCommEnv("SSH_AUTH_SOCK", sshAuthString)
+			}
+
+			// append args with ssh connection backend information (user, host, port)
+			args = append(args, fmt.Sprintf("--hosts=%s://%s@%s", connectionType, user, httpAddr))
 		// somehow not in enum
 		default:
 			ui.Errorf("unsupported ssh authentication type selected: %s", sshAuthType)
 
 			return nil, errors.New("unsupported ssh auth type")
 		}
+
+		// specific agent socket for forwarding with private key auth
+		if sshAuthType != agent && len(provisioner.config.SSHAgentSocket) > 0 {
+			log.Printf("SSH Agent socket location is: %s", provisioner.config.SSHAgentSocket)
+			provisioner.setCommEnv("SSH_AUTH_SOCK", provisioner.config.SSHAgentSocket)
+		}
+
+		// assign ssh certificate file
+		sshCertificateFile := provisioner.determineSSHCertificate(sshAuthType)
+
+		// openssh client extra args are unused by the paramiko backend
+		if connectionType == ssh {
+			// initialize extra args with no strict host key checking
+			extraArgs := []string{"-o StrictHostKeyChecking=no"}
+
+			// certificate accompanying the private key or agent identity
+			if len(sshCertificateFile) > 0 {
+				ui.Say("utilizing SSH certificate for communicator authentication")
+				extraArgs = append(extraArgs, fmt.Sprintf("-o CertificateFile=%s", sshCertificateFile))
+			}
+
+			// agent forwarding
+			if provisioner.config.SSHAgentForwarding {
+				ui.Say("SSH Agent forwarding enabled for testinfra backend")
+				extraArgs = append(extraArgs, "-o ForwardAgent=yes")
+			}
+
+			// keepalive, algorithms, and proxy parameters
+			extraArgs = append(extraArgs, provisioner.determineSSHOptions()...)
+
+			// append args with ssh extra args (each option quoted separately as testinfra interprets them with a shell)
+			quotedArgs := make([]string, 0, len(extraArgs))
+			for _, extraArg := range extraArgs {
+				quotedArgs = append(quotedArgs, shellQuote(extraArg))
+			}
+			args = append(args, fmt.Sprintf("--ssh-extra-args=%s", strings.Join(quotedArgs, " ")))
+		} else {
+			if provisioner.config.SSHAgentForwarding {
+				log.Printf("SSH Agent forwarding is unsupported with the %s connection backend, and will be ignored", connectionType)
+			}
+			if len(sshCertificateFile) > 0 {
+				log.Printf("SSH certificate file is unsupported with the %s connection backend (it is only discovered as the private key file path suffixed with '-cert.pub'), and will be ignored", connectionType)
+			}
+			if options := provisioner.determineSSHOptions(); len(options) > 0 {
+				log.Printf("SSH options %v are unsupported with the %s connection backend, and will be ignored", options, connectionType)
+			}
+		}
 	case winrm:
 		// assign user and host address
 		user, httpAddr, err := provisioner.determineUserAddr(connectionType, ui)
@@ -134,19 +188,223 @@ func (provisioner *Provisioner) determineCommunication(ui packer.Ui) ([]string,
 			return nil, errors.New("unknown instance id")
 		}
 
-		// append args with container connection backend information (instanceid)
+		// container user
+		if user := provisioner.config.ContainerUser; len(user) > 0 {
+			if connectionType == lxc {
+				log.Printf("container user is unsupported with the %s connection backend, and will be ignored", connectionType)
+			} else {
+				log.Printf("testinfra will execute within the container as user: %s", user)
+				instanceID = fmt.Sprintf("%s@%s", user, instanceID)
+			}
+		}
+
+		// container daemon environment
+		if err := provisioner.determineContainerEnv(connectionType, ui); err != nil {
+			return nil, err
+		}
+
+		// append args with container connection backend information (user, instanceid)
 		args = append(args, fmt.Sprintf("--hosts=%s://%s", connectionType, instanceID))
+	case lxd, incus:
+		// determine instance name
+		instanceName, err := provisioner.determineInstanceName(ui)
+		if err != nil {
+			return nil, err
+		}
+
+		// testinfra lxc backend cannot parse a remote in the instance name, and has no incus backend, so wrap the cli as necessary
+		binary := string(lxc)
+		if connectionType == incus {
+			binary = string(incus)
+		}
+		if connectionType == incus || len(provisioner.config.LXDRemote) > 0 {
+			if err := provisioner.lxcShim(binary, provisioner.config.LXDRemote, ui); err != nil {
+				return nil, err
+			}
+		}
+
+		// append args with lxc connection backend information (instance name)
+		args = append(args, fmt.Sprintf("--hosts=%s://%s", lxc, instanceName))
+	case kubectl, openshift:
+		// determine pod name from instanceid
+		podName, ok := provisioner.generatedData["ID"].(string)
+		if !ok || len(podName) == 0 {
+			ui.Error("pod name could not be determined from the instance id")
+			return nil, errors.New("unknown instance id")
+		}
+
+		// append args with pod connection backend information (pod name, context, namespace, container, kubeconfig)
+		args = append(args, appendBackendOptions(fmt.Sprintf("--hosts=%s://%s", connectionType, podName), provisioner.kubectlOptions(connectionType)))
+	case ansible, salt:
+		// determine target host preferably from ssh host
+		target, ok := provisioner.generatedData["SSHHost"].(string)
+		if !ok || len(target) == 0 {
+			// fallback to general host information
+			target, ok = provisioner.generatedData["Host"].(string)
+
+			if !ok || len(target) == 0 {
+				ui.Error("host address could not be determined from available Packer data")
+				return nil, errors.New("unknown host address")
+			}
+		}
+
+		// append args with configuration management connection backend information (target host)
+		args = append(args, fmt.Sprintf("--hosts=%s://%s", connectionType, target))
+	case chroot:
+		// determine chroot mount path
+		mountPath, ok := provisioner.generatedData["MountPath"].(string)
+		if !ok || len(mountPath) == 0 {
+			ui.Error("chroot mount path could not be determined from available Packer data")
+			return nil, errors.New("unknown chroot mount path")
+		}
+		// verify mount path exists and is directory on this device
+		if info, err := os.Stat(mountPath); err != nil || !info.IsDir() {
+			ui.Errorf("the chroot mount path does not exist, is not a directory, or cannot be accessed at: %s", mountPath)
+
+			if err != nil {
+				return nil, err
+			} else {
+				return nil, errors.New("chroot mount path issue")
+			}
+		}
+		// chroot requires elevated permissions
+		if os.Geteuid() != 0 {
+			ui.Say("the testinfra chroot backend requires root privileges, and Packer does not appear to be executing as root")
+		}
+
+		// append args with chroot connection backend information (absolute mount path)
+		args = append(args, fmt.Sprintf("--hosts=chroot://%s", mountPath))
+	case local:
+		// append args with local connection backend information
+		args = append(args, "--hosts=local://")
 	default:
 		// should be unreachable due to earlier enum validation, but here for safety
 		ui.Errorf("communication backend with machine image is not supported, and was resolved to '%s'", connectionType)
 		return nil, errors.New("unsupported communication type")
 	}
 
+	// append backend options to the hosts argument
+	if len(provisioner.config.BackendOptions) > 0 {
+		args[0] = appendBackendOptions(args[0], provisioner.config.BackendOptions)
+	}
+
 	log.Printf("determined communicator arguments as: %+q", args)
 
 	return args, nil
 }
 
+// determine and return connection type by backend override or otherwise packer data
+func (provisioner *Provisioner) determineConnectionType(ui packer.Ui) (connectionType, error) {
+	// determine communication type string by backend override or otherwise packer data
+	connectionString := provisioner.config.Backend
+	if len(connectionString) > 0 {
+		log.Printf("testinfra connection backend override specified as: %s", connectionString)
+	} else {
+		var ok bool
+		connectionString, ok = provisioner.generatedData["ConnType"].(string)
+		if !ok || len(connectionString) == 0 {
+			// chroot builders (e.g. amazon-chroot) populate a mount path instead of communicator data
+			if mountPath, ok := provisioner.generatedData["MountPath"].(string); ok && len(mountPath) > 0 {
+				log.Printf("chroot builder detected from Packer mount path data: %s", mountPath)
+				connectionString = string(chroot)
+			} else {
+				ui.Error("packer is unable to determine the communicator connection type from available data")
+				return "", errors.New("unknown communicator connection type")
+			}
+		}
+	}
+	// convert to enum
+	connectionType, err := connectionType(connectionString).New()
+	if err != nil {
+		ui.Error("packer is using an unsupported connection type")
+		return "", err
+	}
+
+	return connectionType, nil
+}
+
+// determine and return communication args for each separate testinfra execution
+func (provisioner *Provisioner) determineTargets(ui packer.Ui) ([][]string, error) {
+	// no hosts override means only the determined packer communication
+	if len(provisioner.config.Hosts) == 0 {
+		communication, err := provisioner.determineCommunication(ui)
+		if err != nil {
+			return nil, err
+		}
+
+		return [][]string{communication}, nil
+	}
+
+	// render hosts override
+	hosts, err := provisioner.determineHosts(ui)
+	if err != nil {
+		ui.Error("could not accurately determine hosts configuration")
+		return nil, err
+	}
+
+	// determine communication args for each host
+	targets := make([][]string, 0, len(hosts))
+	for _, host := range hosts {
+		if host == packerHost {
+			// reserved entry for determined packer communication
+			communication, err := provisioner.determineCommunication(ui)
+			if err != nil {
+				return nil, err
+			}
+
+			targets = append(targets, communication)
+		} else {
+			targets = append(targets, []string{fmt.Sprintf("--hosts=%s", host)})
+		}
+	}
+
+	// separate execution per host in parallel
+	if provisioner.config.HostsParallel {
+		ui.Sayf("testinfra executing separately for %d hosts in parallel", len(targets))
+		return targets, nil
+	}
+
+	// otherwise combine into single execution: hosts argument is always first and remaining args are shared
+	hostURIs := make([]string, 0, len(targets))
+	var sharedArgs []string
+	for _, communication := range targets {
+		hostURIs = append(hostURIs, strings.TrimPrefix(communication[0], "--hosts="))
+
+		for _, arg := range communication[1:] {
+			if !slices.Contains(sharedArgs, arg) {
+				sharedArgs = append(sharedArgs, arg)
+			}
+		}
+	}
+
+	return [][]string{slices.Insert(sharedArgs, 0, fmt.Sprintf("--hosts=%s", strings.Join(hostURIs, ",")))}, nil
+}
+
+// determine and return rendered hosts override
+func (provisioner *Provisioner) determineHosts(ui packer.Ui) ([]string, error) {
+	// initialize rendered hosts
+	hosts := make([]string, 0, len(provisioner.config.Hosts))
+
+	// render each host uri against packer data
+	for _, host := range provisioner.config.Hosts {
+		renderedHost, err := interpolate.Render(host, &provisioner.config.ctx)
+		if err != nil {
+			ui.Errorf("error parsing config for hosts entry '%s': %v", host, err.Error())
+			return nil, err
+		}
+		if len(renderedHost) == 0 {
+			ui.Errorf("hosts entry '%s' rendered to an empty value", host)
+			return nil, errors.New("empty host")
+		}
+
+		hosts = append(hosts, renderedHost)
+	}
+
+	log.Printf("determined hosts as: %+q", hosts)
+
+	return hosts, nil
+}
+
 // determine and return user and host address
 func (provisioner *Provisioner) determineUserAddr(connType connectionType, ui packer.Ui) (string, string, error) {
 	// ssh and winrm provisioner generated data maps
@@ -229,29 +487,52 @@ func (provisioner *Provisioner) determineSSHAuth(ui packer.Ui) (sshAuth, string,
 	if ok && len(sshPassword) > 0 {
 		return password, sshPassword, nil
 	} else { // ssh is being used with private key or agent auth so determine that instead
-		// parse generated data for ssh private key
+		// parse generated data for ssh private key (a certificate is not a private key, and is instead determined separately)
 		sshPrivateKeyFile, ok := provisioner.generatedData["SSHPrivateKeyFile"].(string)
-		// retry with certificate if necessary
-		if !ok || len(sshPrivateKeyFile) == 0 {
-			sshPrivateKeyFile, ok = provisioner.generatedData["SSHCertificateFile"].(string)
-		}
 
 		if ok && len(sshPrivateKeyFile) > 0 {
-			// we have a specified private key/cert file so use that
+			// we have a specified private key file so use that
 			return privateKey, sshPrivateKeyFile, nil
 		} else if agentAuth, ok := provisioner.generatedData["SSHAgentAuth"].(bool); agentAuth && ok {
-			// we can use an empty/automatic private key with ssh agent auth
-			return agent, "", nil
-		} else { // we have no other options, so create a temp private key file from the packer data
+			// we can use the specified agent socket or an empty/automatic private key with ssh agent auth
+			return agent, provisioner.config.SSHAgentSocket, nil
+		} else { // we have no other options, so create a temp private key file or ephemeral agent from the packer data
 			// attempt to obtain a private key
 			SSHPrivateKey, ok := provisioner.generatedData["SSHPrivateKey"].(string)
 			if !ok || len(SSHPrivateKey) == 0 {
+				// we can still use the specified agent socket with ssh agent auth
+				if len(provisioner.config.SSHAgentSocket) > 0 {
+					return agent, provisioner.config.SSHAgentSocket, nil
+				}
+
 				ui.Error("no SSH authentication information was available in Packer data")
 				return "", "", errors.New("no ssh authentication")
 			}
 
-			// write a tmpfile for storing a private key
-			tmpSSHPrivateKey, err := tmp.File("testinfra-key")
+			// load the private key (and certificate if available) into an ephemeral agent instead of a file
+			if provisioner.config.SSHEphemeralAgent {
+				// reuse the ephemeral agent already loaded with the private key during this provisioning
+				if agentSocket, ok := provisioner.trackedTmpSSHAuth(SSHPrivateKey, agent); ok {
+					return agent, agentSocket, nil
+				}
+
+				agentSocket, err := provisioner.ephemeralAgent(SSHPrivateKey)
+				if err != nil {
+					ui.Error("error loading the ssh private key into an ephemeral ssh agent")
+					return "", "", err
+				}
+				provisioner.trackTmpSSHAuth(SSHPrivateKey, agent, agentSocket)
+
+				return agent, agentSocket, nil
+			}
+
+			// reuse the temp private key file already written during this provisioning
+			if sshPrivateKeyFile, ok := provisioner.trackedTmpSSHAuth(SSHPrivateKey, privateKey); ok {
+				return privateKey, sshPrivateKeyFile, nil
+			}
+
+			// write a tracked tmpfile for storing a private key
+			tmpSSHPrivateKey, err := provisioner.tmpFile("testinfra-key")
 			if err != nil {
 				ui.Error("error creating a temp file for the ssh private key")
 				return "", "", err
@@ -276,11 +557,247 @@ func (provisioner *Provisioner) determineSSHAuth(ui packer.Ui) (sshAuth, string,
 				return "", "", err
 			}
 
+			provisioner.trackTmpSSHAuth(SSHPrivateKey, privateKey, tmpSSHPrivateKey.Name())
+
 			return privateKey, tmpSSHPrivateKey.Name(), nil
 		}
 	}
 }
 
+// determine and return openssh client options for the ssh keepalive, algorithms, and proxy parameters
+func (provisioner *Provisioner) determineSSHOptions() []string {
+	var options []string
+
+	// keepalive interval
+	if keepAlive := provisioner.config.SSHKeepAliveInterval; keepAlive > 0 {
+		options = append(options, fmt.Sprintf("-o ServerAliveInterval=%.0f", max(keepAlive.Seconds(), 1)))
+	}
+
+	// ciphers
+	if ciphers := provisioner.config.SSHCiphers; len(ciphers) > 0 {
+		options = append(options, fmt.Sprintf("-o Ciphers=%s", strings.Join(ciphers, ",")))
+	}
+
+	// key exchange algorithms
+	if kexAlgos := provisioner.config.SSHKEXAlgos; len(kexAlgos) > 0 {
+		options = append(options, fmt.Sprintf("-o KexAlgorithms=%s", strings.Join(kexAlgos, ",")))
+	}
+
+	// socks5 proxy (netcat proxy command does not support socks authentication)
+	if proxyAddr := provisioner.determineSSHProxy(); len(proxyAddr) > 0 {
+		options = append(options, fmt.Sprintf("-o ProxyCommand=nc -X 5 -x %s %%h %%p", proxyAddr))
+	}
+
+	return options
+}
+
+// determine and return socks5 proxy address for ssh from the proxy parameters
+func (provisioner *Provisioner) determineSSHProxy() string {
+	if len(provisioner.config.SSHProxyHost) == 0 {
+		return ""
+	}
+
+	proxyPort := provisioner.config.SSHProxyPort
+	if proxyPort == 0 {
+		proxyPort = 1080
+	}
+
+	return net.JoinHostPort(provisioner.config.SSHProxyHost, strconv.Itoa(proxyPort))
+}
+
+// determine and return lxd or incus instance name from available packer data
+func (provisioner *Provisioner) determineInstanceName(ui packer.Ui) (string, error) {
+	// instance id unless unimplemented by the builder
+	if instanceID, ok := provisioner.generatedData["ID"].(string); ok && len(instanceID) > 0 && !strings.HasPrefix(instanceID, "ERR_") {
+		return instanceID, nil
+	}
+
+	// otherwise instance or container name
+	for _, key := range []string{"InstanceName", "ContainerName"} {
+		if instanceName, ok := provisioner.generatedData[key].(string); ok && len(instanceName) > 0 {
+			log.Printf("instance name determined from Packer %s data: %s", key, instanceName)
+			return instanceName, nil
+		}
+	}
+
+	ui.Error("instance name could not be determined from available Packer data")
+	return "", errors.New("unknown instance name")
+}
+
+// write an lxc cli shim which executes within the instance with the binary and remote, and prepend it to the testinfra PATH
+func (provisioner *Provisioner) lxcShim(binary string, remote string, ui packer.Ui) error {
+	// resolve binary prior to shadowing lxc in the PATH
+	binaryPath, err := exec.LookPath(binary)
+	if err != nil {
+		ui.Errorf("%s is not installed or not found in the system path", binary)
+		return errors.New(binary + " installation not found")
+	}
+
+	// tracked tmpdir for the shim
+	shimDir, err := os.MkdirTemp("", "testinfra-lxc")
+	if err != nil {
+		log.Print("error creating a temp directory for the lxc shim")
+		return err
+	}
+	provisioner.trackTmpArtifact(shimDir)
+
+	// testinfra executes 'lxc exec <name> ...', so prefix the instance name with the remote
+	if len(remote) > 0 {
+		remote += ":"
+	}
+	script := fmt.Sprintf("#!/bin/sh\nsubcommand=\"$1\"\nshift\nname=\"$1\"\nshift\nexec %s \"$subcommand\" %s\"$name\" \"$@\"\n", shellQuote(binaryPath), shellQuote(remote))
+	if err = os.WriteFile(filepath.Join(shimDir, string(lxc)), []byte(script), 0o700); err != nil {
+		log.Print("error writing the lxc shim")
+		return err
+	}
+
+	log.Printf("testinfra lxc backend will execute via %s with remote '%s'", binaryPath, remote)
+	provisioner.setCommEnv("PATH", shimDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	return nil
+}
+
+// determine environment for the remote or rootless container daemon
+func (provisioner *Provisioner) determineContainerEnv(connectionType connectionType, ui packer.Ui) error {
+	switch connectionType {
+	case docker:
+		if len(provisioner.config.ContainerHost) > 0 {
+			log.Printf("testinfra will communicate with the docker daemon at: %s", provisioner.config.ContainerHost)
+			provisioner.setCommEnv("DOCKER_HOST", provisioner.config.ContainerHost)
+		}
+	case podman:
+		if len(provisioner.config.PodmanConnection) > 0 {
+			// named podman system connection
+			log.Printf("testinfra will communicate with the podman system connection: %s", provisioner.config.PodmanConnection)
+			provisioner.setCommEnv("CONTAINER_CONNECTION", provisioner.config.PodmanConnection)
+		} else if len(provisioner.config.ContainerHost) > 0 {
+			log.Printf("testinfra will communicate with the podman service at: %s", provisioner.config.ContainerHost)
+			provisioner.setCommEnv("CONTAINER_HOST", provisioner.config.ContainerHost)
+		} else if provisioner.config.PodmanRootless {
+			// rootless podman user service socket
+			runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+			if len(runtimeDir) == 0 {
+				runtimeDir = fmt.Sprintf("/run/user/%d", os.Getuid())
+			}
+			socket := filepath.Join(runtimeDir, "podman", "podman.sock")
+
+			if _, err := os.Stat(socket); err != nil {
+				ui.Errorf("the rootless podman socket could not be accessed at %s; it can be enabled with 'systemctl --user enable --now podman.socket'", socket)
+				return err
+			}
+
+			log.Printf("testinfra will communicate with the rootless podman service at: %s", socket)
+			provisioner.setCommEnv("CONTAINER_HOST", "unix://"+socket)
+		}
+	default:
+		if len(provisioner.config.ContainerHost) > 0 {
+			log.Printf("container host is unsupported with the %s connection backend, and will be ignored", connectionType)
+		}
+	}
+
+	return nil
+}
+
+// determine and return ssh certificate file location accompanying the ssh authentication
+func (provisioner *Provisioner) determineSSHCertificate(sshAuthType sshAuth) string {
+	sshCertificateFile := provisioner.config.SSHCertificateFile
+	if len(sshCertificateFile) == 0 {
+		return ""
+	}
+
+	// certificates authenticate only with the corresponding private key
+	if sshAuthType == password {
+		log.Print("SSH certificate file is unused with password authentication, and will be ignored")
+		return ""
+	}
+
+	log.Printf("SSH certificate file location is: %s", sshCertificateFile)
+
+	return sshCertificateFile
+}
+
+// parse and return ssh certificate from file
+func parseSSHCertificate(sshCertificateFile string) (*gossh.Certificate, error) {
+	certificateBytes, err := os.ReadFile(sshCertificateFile)
+	if err != nil {
+		log.Printf("unable to read ssh certificate at: %s", sshCertificateFile)
+		return nil, err
+	}
+	publicKey, _, _, _, err := gossh.ParseAuthorizedKey(certificateBytes)
+	if err != nil {
+		log.Printf("unable to parse ssh certificate at: %s", sshCertificateFile)
+		return nil, err
+	}
+	certificate, ok := publicKey.(*gossh.Certificate)
+	if !ok {
+		log.Printf("ssh public key at %s is not a certificate", sshCertificateFile)
+		return nil, errors.New("invalid ssh certificate")
+	}
+
+	return certificate, nil
+}
+
+// load ssh private key into an ephemeral in-process agent, and return the agent socket location
+func (provisioner *Provisioner) ephemeralAgent(sshPrivateKey string) (string, error) {
+	// parse private key and add to in-memory keyring
+	rawPrivateKey, err := gossh.ParseRawPrivateKey([]byte(sshPrivateKey))
+	if err != nil {
+		log.Print("the ssh private key could not be parsed")
+		return "", err
+	}
+	addedKey := sshagent.AddedKey{PrivateKey: rawPrivateKey, Comment: "packer-plugin-testinfra"}
+
+	// agent identity is the certificate if available
+	if sshCertificateFile := provisioner.determineSSHCertificate(agent); len(sshCertificateFile) > 0 {
+		certificate, err := parseSSHCertificate(sshCertificateFile)
+		if err != nil {
+			return "", err
+		}
+		addedKey.Certificate = certificate
+	}
+
+	keyring := sshagent.NewKeyring()
+	if err = keyring.Add(addedKey); err != nil {
+		log.Print("the ssh private key could not be added to the ephemeral agent keyring")
+		return "", err
+	}
+
+	// tracked tmpdir (accessible only by owner) for the agent socket
+	socketDir, err := os.MkdirTemp("", "testinfra-agent")
+	if err != nil {
+		log.Print("error creating a temp directory for the ssh agent socket")
+		return "", err
+	}
+	provisioner.trackTmpArtifact(socketDir)
+
+	// listen on agent socket
+	agentSocket := filepath.Join(socketDir, "agent.sock")
+	listener, err := net.Listen("unix", agentSocket)
+	if err != nil {
+		log.Printf("unable to listen on ssh agent socket at: %s", agentSocket)
+		return "", err
+	}
+	provisioner.trackTmpCloser(listener)
+
+	// serve agent protocol for each connection until listener is closed
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				sshagent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+
+	log.Printf("ssh private key loaded into ephemeral agent at socket: %s", agentSocket)
+
+	return agentSocket, nil
+}
+
 // determine and return winrm optional arguments
 func (provisioner *Provisioner) determineWinRMArgs(ui packer.Ui) ([]string, error) {
 	// declare optional args slice to contain and later return
@@ -296,6 +813,14 @@ func (provisioner *Provisioner) determineWinRMArgs(ui packer.Ui) ([]string, erro
 	if insecure, ok := provisioner.generatedData["WinRMInsecure"].(bool); ok && insecure {
 		optionalArgs = append(optionalArgs, "no_verify_ssl=true")
 		ui.Say("winrm ssl verification disabled for testinfra backend")
+
+		if len(provisioner.config.WinRMCATrustPath) > 0 {
+			log.Print("winrm ca trust path is unused without ssl verification, and will be ignored")
+		}
+	} else if len(provisioner.config.WinRMCATrustPath) > 0 {
+		// pywinrm verifies with the requests ca bundle environment variable
+		provisioner.setCommEnv("REQUESTS_CA_BUNDLE", provisioner.config.WinRMCATrustPath)
+		ui.Sayf("winrm ssl verification with ca bundle %s for testinfra backend", provisioner.config.WinRMCATrustPath)
 	}
 	// check on timeout
 	if timeout, ok := provisioner.generatedData["WinRMTimeout"].(time.Duration); ok {
@@ -1,15 +1,24 @@
 package testinfra
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
 	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/packer-plugin-sdk/packer"
+	gossh "golang.org/x/crypto/ssh"
+	sshagent "golang.org/x/crypto/ssh/agent"
 )
 
 // test provisioner determineCommunication properly determines communication strings
@@ -44,7 +53,7 @@ func TestProvisionerDetermineCommunication(test *testing.T) {
 	if err != nil {
 		test.Errorf("determineCommunication function failed to determine ssh: %s", err)
 	}
-	if !slices.Equal(communication, []string{fmt.Sprintf("--hosts=ssh://%s:%s@%s:%d?timeout=%.0f", provisioner.generatedData["SSHUsername"], provisioner.generatedData["SSHPassword"], provisioner.generatedData["SSHHost"], provisioner.generatedData["SSHPort"], sshTimeout.Seconds()), "--ssh-extra-args=\"-o StrictHostKeyChecking=no\""}) {
+	if !slices.Equal(communication, []string{fmt.Sprintf("--hosts=ssh://%s:%s@%s:%d?timeout=%.0f", provisioner.generatedData["SSHUsername"], provisioner.generatedData["SSHPassword"], provisioner.generatedData["SSHHost"], provisioner.generatedData["SSHPort"], sshTimeout.Seconds()), "--ssh-extra-args='-o StrictHostKeyChecking=no'"}) {
 		test.Errorf("communication string slice for ssh password incorrectly determined: %v", communication)
 	}
 
@@ -63,10 +72,22 @@ func TestProvisionerDetermineCommunication(test *testing.T) {
 	if err != nil {
 		test.Errorf("determineCommunication function failed to determine ssh: %s", err)
 	}
-	if !slices.Equal(communication, []string{fmt.Sprintf("--hosts=ssh://%s@%s:%d", provisioner.generatedData["SSHUsername"], provisioner.generatedData["SSHHost"], provisioner.generatedData["SSHPort"]), fmt.Sprintf("--ssh-identity-file=%s", provisioner.generatedData["SSHPrivateKeyFile"]), "--ssh-extra-args=\"-o StrictHostKeyChecking=no\""}) {
+	if !slices.Equal(communication, []string{fmt.Sprintf("--hosts=ssh://%s@%s:%d", provisioner.generatedData["SSHUsername"], provisioner.generatedData["SSHHost"], provisioner.generatedData["SSHPort"]), fmt.Sprintf("--ssh-identity-file=%s", provisioner.generatedData["SSHPrivateKeyFile"]), "--ssh-extra-args='-o StrictHostKeyChecking=no'"}) {
 		test.Errorf("communication string slice for ssh private key incorrectly determined: %v", communication)
 	}
 
+	// test ssh with private key file and certificate
+	provisioner.config.SSHCertificateFile = "/path/to/sshprivatekeyfile-cert.pub"
+
+	communication, err = provisioner.determineCommunication(ui)
+	if err != nil {
+		test.Errorf("determineCommunication function failed to determine ssh: %s", err)
+	}
+	if !slices.Equal(communication, []string{fmt.Sprintf("--hosts=ssh://%s@%s:%d", provisioner.generatedData["SSHUsername"], provisioner.generatedData["SSHHost"], provisioner.generatedData["SSHPort"]), fmt.Sprintf("--ssh-identity-file=%s", provisioner.generatedData["SSHPrivateKeyFile"]), fmt.Sprintf("--ssh-extra-args='-o StrictHostKeyChecking=no' '-o CertificateFile=%s'", provisioner.config.SSHCertificateFile)}) {
+		test.Errorf("communication string slice for ssh private key and certificate incorrectly determined: %v", communication)
+	}
+	provisioner.config.SSHCertificateFile = ""
+
 	// test ssh with no private key but with agent auth
 	provisioner.generatedData["SSHPrivateKeyFile"] = ""
 	provisioner.generatedData["SSHAgentAuth"] = true
@@ -75,10 +96,43 @@ func TestProvisionerDetermineCommunication(test *testing.T) {
 	if err != nil {
 		test.Errorf("determineCommunication function failed to determine ssh: %s", err)
 	}
-	if !slices.Equal(communication, []string{fmt.Sprintf("--hosts=ssh://%s@%s:%d", provisioner.generatedData["SSHUsername"], provisioner.generatedData["SSHHost"], provisioner.generatedData["SSHPort"]), "--ssh-extra-args=\"-o StrictHostKeyChecking=no\""}) {
+	if !slices.Equal(communication, []string{fmt.Sprintf("--hosts=ssh://%s@%s:%d", provisioner.generatedData["SSHUsername"], provisioner.generatedData["SSHHost"], provisioner.generatedData["SSHPort"]), "--ssh-extra-args='-o StrictHostKeyChecking=no'"}) {
 		test.Errorf("communication string slice for ssh agent auth incorrectly determined: %v", communication)
 	}
 
+	// test ssh with agent socket and forwarding
+	provisioner.config.SSHAgentSocket = "/path/to/agent.sock"
+	provisioner.config.SSHAgentForwarding = true
+
+	communication, err = provisioner.determineCommunication(ui)
+	if err != nil {
+		test.Errorf("determineCommunication function failed to determine ssh: %s", err)
+	}
+	if !slices.Equal(communication, []string{fmt.Sprintf("--hosts=ssh://%s@%s:%d", provisioner.generatedData["SSHUsername"], provisioner.generatedData["SSHHost"], provisioner.generatedData["SSHPort"]), "--ssh-extra-args='-o StrictHostKeyChecking=no' '-o ForwardAgent=yes'"}) {
+		test.Errorf("communication string slice for ssh agent socket and forwarding incorrectly determined: %v", communication)
+	}
+	if provisioner.commEnv["SSH_AUTH_SOCK"] != provisioner.config.SSHAgentSocket {
+		test.Errorf("ssh agent socket environment incorrectly determined: %v", provisioner.commEnv)
+	}
+	provisioner.commEnv = nil
+
+	// test ssh with private key file, agent socket, and forwarding
+	provisioner.generatedData["SSHPrivateKeyFile"] = "/path/to/sshprivatekeyfile"
+	provisioner.generatedData["SSHAgentAuth"] = false
+
+	communication, err = provisioner.determineCommunication(ui)
+	if err != nil {
+		test.Errorf("determineCommunication function failed to determine ssh: %s", err)
+	}
+	if !slices.Equal(communication, []string{fmt.Sprintf("--hosts=ssh://%s@%s:%d", provisioner.generatedData["SSHUsername"], provisioner.generatedData["SSHHost"], provisioner.generatedData["SSHPort"]), fmt.Sprintf("--ssh-identity-file=%s", provisioner.generatedData["SSHPrivateKeyFile"]), "--ssh-extra-args='-o StrictHostKeyChecking=no' '-o ForwardAgent=yes'"}) {
+		test.Errorf("communication string slice for ssh private key with agent socket and forwarding incorrectly determined: %v", communication)
+	}
+	if provisioner.commEnv["SSH_AUTH_SOCK"] != provisioner.config.SSHAgentSocket {
+		test.Errorf("forwarded ssh agent socket environment incorrectly determined: %v", provisioner.commEnv)
+	}
+	provisioner.config = Config{}
+	provisioner.commEnv = nil
+
 	// test winrm
 	provisioner.generatedData = map[string]any{
 		"ConnType":      "winrm",
@@ -135,6 +189,22 @@ func TestProvisionerDetermineCommunication(test *testing.T) {
 		test.Errorf("communication string slice for podman incorrectly determined: %v", communication)
 	}
 
+	// test podman with user and connection
+	provisioner.config = Config{ContainerUser: "tester", PodmanConnection: "remote"}
+
+	communication, err = provisioner.determineCommunication(ui)
+	if err != nil {
+		test.Errorf("determineCommunication function failed to determine podman: %s", err)
+	}
+	if !slices.Equal(communication, []string{fmt.Sprintf("--hosts=podman://tester@%s", provisioner.generatedData["ID"])}) {
+		test.Errorf("communication string slice for podman user incorrectly determined: %v", communication)
+	}
+	if provisioner.commEnv["CONTAINER_CONNECTION"] != "remote" {
+		test.Errorf("podman connection environment incorrectly determined: %v", provisioner.commEnv)
+	}
+	provisioner.config = Config{}
+	provisioner.commEnv = nil
+
 	// test lxc
 	provisioner.generatedData = map[string]any{
 		"ConnType": "lxc",
@@ -149,11 +219,154 @@ func TestProvisionerDetermineCommunication(test *testing.T) {
 		test.Errorf("communication string slice for lxc incorrectly determined: %v", communication)
 	}
 
-	delete(provisioner.generatedData, "ID")
+	// test lxd with instance name fallback from unimplemented instance id
+	provisioner.generatedData = map[string]any{
+		"ConnType":     "lxd",
+		"ID":           "ERR_ID_NOT_IMPLEMENTED_BY_BUILDER",
+		"InstanceName": "packer-instance",
+	}
+
+	communication, err = provisioner.determineCommunication(ui)
+	if err != nil {
+		test.Errorf("determineCommunication function failed to determine lxd: %s", err)
+	}
+	if !slices.Equal(communication, []string{"--hosts=lxc://packer-instance"}) {
+		test.Errorf("communication string slice for lxd incorrectly determined: %v", communication)
+	}
+	if len(provisioner.commEnv) > 0 {
+		test.Errorf("lxd without remote incorrectly determined environment: %v", provisioner.commEnv)
+	}
+
+	// test incus requires incus cli
+	provisioner.generatedData["ConnType"] = "incus"
+	if _, err = provisioner.determineCommunication(ui); err == nil || err.Error() != "incus installation not found" {
+		test.Error("determineCommunication did not fail on missing incus installation")
+		test.Error(err)
+	}
+
+	// test unknown instance id
+	provisioner.generatedData = map[string]any{"ConnType": "lxc"}
 	if _, err = provisioner.determineCommunication(ui); err == nil || err.Error() != "unknown instance id" {
 		test.Error("determineCommunication did not fail on unknown instance id")
 	}
 
+	// test paramiko backend override with password and no sshpass requirement
+	provisioner.config = Config{Backend: "paramiko"}
+	provisioner.generatedData = map[string]any{
+		"ConnType":    "ssh",
+		"SSHUsername": "me",
+		"SSHPassword": "password",
+		"SSHHost":     "192.168.0.1",
+		"SSHPort":     22,
+	}
+	test.Setenv("PATH", "")
+
+	communication, err = provisioner.determineCommunication(ui)
+	if err != nil {
+		test.Errorf("determineCommunication function failed to determine paramiko: %s", err)
+	}
+	if !slices.Equal(communication, []string{fmt.Sprintf("--hosts=paramiko://%s:%s@%s:%d", provisioner.generatedData["SSHUsername"], provisioner.generatedData["SSHPassword"], provisioner.generatedData["SSHHost"], provisioner.generatedData["SSHPort"])}) {
+		test.Errorf("communication string slice for paramiko incorrectly determined: %v", communication)
+	}
+
+	// test ansible backend override with backend options
+	provisioner.config = Config{
+		Backend:        "ansible",
+		BackendOptions: map[string]string{"ansible_inventory": "/etc/ansible/inventory", "force_ansible": "true"},
+	}
+
+	communication, err = provisioner.determineCommunication(ui)
+	if err != nil {
+		test.Errorf("determineCommunication function failed to determine ansible: %s", err)
+	}
+	if !slices.Equal(communication, []string{fmt.Sprintf("--hosts=ansible://%s?ansible_inventory=/etc/ansible/inventory&force_ansible=true", provisioner.generatedData["SSHHost"])}) {
+		test.Errorf("communication string slice for ansible incorrectly determined: %v", communication)
+	}
+
+	// test kubectl backend override with backend options
+	provisioner.config = Config{
+		Backend:        "kubectl",
+		BackendOptions: map[string]string{"namespace": "test", "container": "app"},
+	}
+	provisioner.generatedData = map[string]any{"ID": "mypod"}
+
+	communication, err = provisioner.determineCommunication(ui)
+	if err != nil {
+		test.Errorf("determineCommunication function failed to determine kubectl: %s", err)
+	}
+	if !slices.Equal(communication, []string{"--hosts=kubectl://mypod?container=app&namespace=test"}) {
+		test.Errorf("communication string slice for kubectl incorrectly determined: %v", communication)
+	}
+
+	// test kubectl settings with consistent backend options
+	provisioner.config = Config{
+		Backend:          "kubectl",
+		BackendOptions:   map[string]string{"namespace": "test"},
+		KubectlContext:   "kind-packer",
+		KubectlNamespace: "test",
+		KubectlContainer: "app",
+	}
+
+	communication, err = provisioner.determineCommunication(ui)
+	if err != nil {
+		test.Errorf("determineCommunication function failed to determine kubectl: %s", err)
+	}
+	if !slices.Equal(communication, []string{"--hosts=kubectl://mypod?container=app&context=kind-packer&namespace=test"}) {
+		test.Errorf("communication string slice for kubectl settings incorrectly determined: %v", communication)
+	}
+
+	// test chroot detection from mount path
+	provisioner.config = Config{}
+	mountPath := test.TempDir()
+	provisioner.generatedData = map[string]any{"MountPath": mountPath}
+
+	communication, err = provisioner.determineCommunication(ui)
+	if err != nil {
+		test.Errorf("determineCommunication function failed to detect chroot: %s", err)
+	}
+	if !slices.Equal(communication, []string{fmt.Sprintf("--hosts=chroot://%s", mountPath)}) {
+		test.Errorf("communication string slice for detected chroot incorrectly determined: %v", communication)
+	}
+
+	// test chroot backend override
+	provisioner.config = Config{Backend: "chroot"}
+
+	communication, err = provisioner.determineCommunication(ui)
+	if err != nil {
+		test.Errorf("determineCommunication function failed to determine chroot: %s", err)
+	}
+	if !slices.Equal(communication, []string{fmt.Sprintf("--hosts=chroot://%s", mountPath)}) {
+		test.Errorf("communication string slice for chroot incorrectly determined: %v", communication)
+	}
+
+	provisioner.generatedData["MountPath"] = "/mnt/packer-amazon-chroot-volumes/xvdf"
+	if _, err = provisioner.determineCommunication(ui); err == nil || !errors.Is(err, os.ErrNotExist) {
+		test.Error("determineCommunication did not fail on nonexistent chroot mount path")
+	}
+
+	delete(provisioner.generatedData, "MountPath")
+	if _, err = provisioner.determineCommunication(ui); err == nil || err.Error() != "unknown chroot mount path" {
+		test.Error("determineCommunication did not fail on unknown chroot mount path")
+	}
+
+	// test local backend override
+	provisioner.config = Config{Backend: "local"}
+
+	communication, err = provisioner.determineCommunication(ui)
+	if err != nil {
+		test.Errorf("determineCommunication function failed to determine local: %s", err)
+	}
+	if !slices.Equal(communication, []string{"--hosts=local://"}) {
+		test.Errorf("communication string slice for local incorrectly determined: %v", communication)
+	}
+
+	// test fails on unsupported backend override
+	provisioner.config = Config{Backend: "foo"}
+	if _, err = provisioner.determineCommunication(ui); err == nil || err.Error() != "invalid connection enum" {
+		test.Error("determineCommunication function did not fail on unsupported backend override")
+	}
+	provisioner.config = Config{}
+
 	// test fails on no communication
 	provisioner.generatedData = map[string]any{
 		"ConnType": "unknown",
@@ -175,6 +388,86 @@ func TestProvisionerDetermineCommunication(test *testing.T) {
 	}
 }
 
+// test provisioner determineTargets properly combines or separates hosts
+func TestProvisionerDetermineTargets(test *testing.T) {
+	var provisioner Provisioner
+	ui := packer.TestUi(test)
+
+	provisioner.generatedData = map[string]any{
+		"ConnType":          "ssh",
+		"User":              "me",
+		"Host":              "192.168.0.1",
+		"Port":              22,
+		"SSHPrivateKeyFile": "/path/to/sshprivatekeyfile",
+	}
+
+	// test no hosts override is packer communication
+	targets, err := provisioner.determineTargets(ui)
+	if err != nil {
+		test.Errorf("determineTargets function failed to determine packer communication: %s", err)
+	}
+	packerCommunication := []string{"--hosts=ssh://me@192.168.0.1:22", "--ssh-identity-file=/path/to/sshprivatekeyfile", "--ssh-extra-args='-o StrictHostKeyChecking=no'"}
+	if len(targets) != 1 || !slices.Equal(targets[0], packerCommunication) {
+		test.Errorf("targets for packer communication incorrectly determined: %v", targets)
+	}
+
+	// test combined hosts with packer communication
+	provisioner.config.Hosts = []string{"packer", "docker://sidecar"}
+
+	targets, err = provisioner.determineTargets(ui)
+	if err != nil {
+		test.Errorf("determineTargets function failed to determine combined hosts: %s", err)
+	}
+	if len(targets) != 1 || !slices.Equal(targets[0], []string{"--hosts=ssh://me@192.168.0.1:22,docker://sidecar", "--ssh-identity-file=/path/to/sshprivatekeyfile", "--ssh-extra-args='-o StrictHostKeyChecking=no'"}) {
+		test.Errorf("targets for combined hosts incorrectly determined: %v", targets)
+	}
+
+	// test separate hosts in parallel
+	provisioner.config.HostsParallel = true
+
+	targets, err = provisioner.determineTargets(ui)
+	if err != nil {
+		test.Errorf("determineTargets function failed to determine parallel hosts: %s", err)
+	}
+	if len(targets) != 2 || !slices.Equal(targets[0], packerCommunication) || !slices.Equal(targets[1], []string{"--hosts=docker://sidecar"}) {
+		test.Errorf("targets for parallel hosts incorrectly determined: %v", targets)
+	}
+}
+
+// test provisioner determineHosts properly renders hosts override
+func TestProvisionerDetermineHosts(test *testing.T) {
+	var provisioner Provisioner
+	ui := packer.TestUi(test)
+
+	provisioner.config.Hosts = []string{"ssh://{{ .User }}@{{ .Host }}:2222", "docker://sidecar"}
+	provisioner.config.ctx.Data = map[string]any{
+		"User": "me",
+		"Host": "192.168.0.1",
+	}
+
+	hosts, err := provisioner.determineHosts(ui)
+	if err != nil {
+		test.Errorf("determineHosts function failed to render hosts: %s", err)
+	}
+	if expectedHosts := []string{"ssh://me@192.168.0.1:2222", "docker://sidecar"}; !slices.Equal(hosts, expectedHosts) {
+		test.Error("hosts were incorrectly rendered")
+		test.Errorf("actual: %+q, expected: %+q", hosts, expectedHosts)
+	}
+
+	// test invalid template
+	provisioner.config.Hosts = []string{"ssh://{{ .User "}
+	if _, err = provisioner.determineHosts(ui); err == nil {
+		test.Error("determineHosts function did not fail on invalid template")
+	}
+
+	// test empty rendered host
+	provisioner.config.Hosts = []string{""}
+	if _, err = provisioner.determineHosts(ui); err == nil || err.Error() != "empty host" {
+		test.Error("determineHosts function did not fail on empty host")
+		test.Error(err)
+	}
+}
+
 // test provisioner determineUserAddr properly determines user and instance address
 func TestDetermineUserAddr(test *testing.T) {
 	var provisioner Provisioner
@@ -218,6 +511,187 @@ func TestDetermineUserAddr(test *testing.T) {
 	}
 }
 
+// helper function to sign and write an ssh certificate for the private key
+func sshTestCertificate(test *testing.T, rawPrivateKey ed25519.PrivateKey) string {
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		test.Fatal(err)
+	}
+	caSigner, err := gossh.NewSignerFromKey(caKey)
+	if err != nil {
+		test.Fatal(err)
+	}
+	publicKey, err := gossh.NewPublicKey(rawPrivateKey.Public())
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	certificate := &gossh.Certificate{
+		Key:             publicKey,
+		CertType:        gossh.UserCert,
+		ValidPrincipals: []string{"me"},
+		ValidBefore:     gossh.CertTimeInfinity,
+	}
+	if err = certificate.SignCert(rand.Reader, caSigner); err != nil {
+		test.Fatal(err)
+	}
+
+	certificateFile := filepath.Join(test.TempDir(), "key-cert.pub")
+	if err = os.WriteFile(certificateFile, gossh.MarshalAuthorizedKey(certificate), 0o600); err != nil {
+		test.Fatal(err)
+	}
+
+	return certificateFile
+}
+
+// test provisioner determineInstanceName properly determines lxd and incus instance names
+func TestProvisionerDetermineInstanceName(test *testing.T) {
+	ui := packer.TestUi(test)
+	provisioner := &Provisioner{generatedData: map[string]any{
+		"ID":            "ERR_ID_NOT_IMPLEMENTED_BY_BUILDER",
+		"ContainerName": "packer-container",
+	}}
+
+	if instanceName, err := provisioner.determineInstanceName(ui); err != nil || instanceName != "packer-container" {
+		test.Errorf("instance name incorrectly determined from container name: %s %v", instanceName, err)
+	}
+
+	provisioner.generatedData["ID"] = "packer-id"
+	if instanceName, err := provisioner.determineInstanceName(ui); err != nil || instanceName != "packer-id" {
+		test.Errorf("instance name incorrectly determined from instance id: %s %v", instanceName, err)
+	}
+
+	provisioner.generatedData = map[string]any{}
+	if _, err := provisioner.determineInstanceName(ui); err == nil || err.Error() != "unknown instance name" {
+		test.Error("determineInstanceName did not fail on missing instance name")
+		test.Error(err)
+	}
+}
+
+// test provisioner lxcShim executes within the instance with the binary and remote
+func TestProvisionerLXCShim(test *testing.T) {
+	ui := packer.TestUi(test)
+	var provisioner Provisioner
+
+	// fake incus which echoes its arguments
+	incusDir := test.TempDir()
+	os.WriteFile(filepath.Join(incusDir, "incus"), []byte("#!/bin/sh\necho \"$@\"\n"), 0o700)
+	test.Setenv("PATH", incusDir+":"+os.Getenv("PATH"))
+
+	if err := provisioner.lxcShim("incus", "remote", ui); err != nil {
+		test.Fatalf("lxcShim function failed: %s", err)
+	}
+
+	// test shim is prepended to the testinfra path and executes the binary with the remote
+	shimDir, _, _ := strings.Cut(provisioner.commEnv["PATH"], ":")
+	output, err := exec.Command(filepath.Join(shimDir, "lxc"), "exec", "packer-instance", "--", "/bin/sh", "-c", "true").Output()
+	if err != nil || string(output) != "exec remote:packer-instance -- /bin/sh -c true\n" {
+		test.Errorf("lxc shim incorrectly executed: %s %v", output, err)
+	}
+
+	// test shim is removed
+	provisioner.cleanupTmpArtifacts()
+	if _, err = os.Stat(shimDir); !errors.Is(err, os.ErrNotExist) {
+		test.Errorf("lxc shim was not removed: %s", shimDir)
+	}
+}
+
+// test provisioner determineContainerEnv properly determines container daemon environment
+func TestProvisionerDetermineContainerEnv(test *testing.T) {
+	ui := packer.TestUi(test)
+	provisioner := &Provisioner{config: Config{ContainerHost: "tcp://192.168.0.1:2376"}}
+
+	// test docker remote daemon
+	if err := provisioner.determineContainerEnv(docker, ui); err != nil || provisioner.commEnv["DOCKER_HOST"] != provisioner.config.ContainerHost {
+		test.Errorf("docker host environment incorrectly determined: %v %v", provisioner.commEnv, err)
+	}
+
+	// test podman remote service
+	provisioner.commEnv = nil
+	if err := provisioner.determineContainerEnv(podman, ui); err != nil || provisioner.commEnv["CONTAINER_HOST"] != provisioner.config.ContainerHost {
+		test.Errorf("podman host environment incorrectly determined: %v %v", provisioner.commEnv, err)
+	}
+
+	// test podman rootless socket
+	runtimeDir := test.TempDir()
+	test.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+	provisioner.config = Config{PodmanRootless: true}
+	provisioner.commEnv = nil
+
+	if err := provisioner.determineContainerEnv(podman, ui); !errors.Is(err, os.ErrNotExist) {
+		test.Errorf("determineContainerEnv did not fail on missing rootless podman socket: %v", err)
+	}
+
+	os.Mkdir(filepath.Join(runtimeDir, "podman"), 0o700)
+	os.WriteFile(filepath.Join(runtimeDir, "podman", "podman.sock"), nil, 0o600)
+	if err := provisioner.determineContainerEnv(podman, ui); err != nil || provisioner.commEnv["CONTAINER_HOST"] != "unix://"+filepath.Join(runtimeDir, "podman", "podman.sock") {
+		test.Errorf("rootless podman environment incorrectly determined: %v %v", provisioner.commEnv, err)
+	}
+}
+
+// test provisioner determineSSHOptions properly determines openssh client options
+func TestProvisionerDetermineSSHOptions(test *testing.T) {
+	provisioner := &Provisioner{}
+
+	// test no options without parameters
+	if options := provisioner.determineSSHOptions(); len(options) > 0 {
+		test.Errorf("ssh options incorrectly determined without parameters: %v", options)
+	}
+
+	// test all options
+	provisioner.config = Config{
+		SSHKeepAliveInterval: 5 * time.Second,
+		SSHCiphers:           []string{"aes128-gcm@openssh.com", "aes256-ctr"},
+		SSHKEXAlgos:          []string{"curve25519-sha256"},
+		SSHProxyHost:         "proxy.example.com",
+		SSHProxyPort:         1081,
+	}
+
+	if options := provisioner.determineSSHOptions(); !slices.Equal(options, []string{"-o ServerAliveInterval=5", "-o Ciphers=aes128-gcm@openssh.com,aes256-ctr", "-o KexAlgorithms=curve25519-sha256", "-o ProxyCommand=nc -X 5 -x proxy.example.com:1081 %h %p"}) {
+		test.Errorf("ssh options incorrectly determined: %v", options)
+	}
+
+	// test default proxy port
+	provisioner.config = Config{SSHProxyHost: "proxy.example.com"}
+	if options := provisioner.determineSSHOptions(); !slices.Equal(options, []string{"-o ProxyCommand=nc -X 5 -x proxy.example.com:1080 %h %p"}) {
+		test.Errorf("ssh proxy option incorrectly determined with default port: %v", options)
+	}
+}
+
+// test provisioner determineSSHCertificate properly determines certificate information
+func TestProvisionerDetermineSSHCertificate(test *testing.T) {
+	provisioner := &Provisioner{config: Config{SSHCertificateFile: "/path/to/key-cert.pub"}}
+
+	if certificateFile := provisioner.determineSSHCertificate(privateKey); certificateFile != provisioner.config.SSHCertificateFile {
+		test.Errorf("ssh certificate file location incorrectly determined: %s", certificateFile)
+	}
+	if certificateFile := provisioner.determineSSHCertificate(password); len(certificateFile) > 0 {
+		test.Errorf("ssh certificate file was not ignored with password authentication: %s", certificateFile)
+	}
+
+	provisioner.config.SSHCertificateFile = ""
+	if certificateFile := provisioner.determineSSHCertificate(agent); len(certificateFile) > 0 {
+		test.Errorf("ssh certificate file location incorrectly determined without parameter: %s", certificateFile)
+	}
+
+	// test certificate parsing
+	_, rawPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		test.Fatal(err)
+	}
+	if certificate, err := parseSSHCertificate(sshTestCertificate(test, rawPrivateKey)); err != nil || certificate.CertType != gossh.UserCert {
+		test.Errorf("ssh certificate was not parsed: %s", err)
+	}
+
+	publicKeyFile := filepath.Join(test.TempDir(), "key.pub")
+	publicKey, _ := gossh.NewPublicKey(rawPrivateKey.Public())
+	os.WriteFile(publicKeyFile, gossh.MarshalAuthorizedKey(publicKey), 0o600)
+	if _, err = parseSSHCertificate(publicKeyFile); err == nil || err.Error() != "invalid ssh certificate" {
+		test.Error("parseSSHCertificate did not fail on a public key which is not a certificate")
+		test.Error(err)
+	}
+}
+
 // test provisioner determineSSHAuth properly determines authentication information
 func TestProvisionerDetermineSSHAuth(test *testing.T) {
 	var provisioner Provisioner
@@ -291,8 +765,108 @@ func TestProvisionerDetermineSSHAuth(test *testing.T) {
 	if sshPrivateKey, _ := os.ReadFile(sshAuthString); string(sshPrivateKey) != provisioner.generatedData["SSHPrivateKey"] {
 		test.Errorf("temporary ssh key file content is not the ssh private key: %s", sshPrivateKey)
 	}
+	if info, err := os.Stat(sshAuthString); err != nil || info.Mode().Perm() != 0o600 {
+		test.Errorf("temporary ssh key file permissions are not restricted to owner: %v", info)
+	}
+
+	// test temporary ssh key file is reused instead of rewritten
+	if _, reusedAuthString, err := provisioner.determineSSHAuth(ui); err != nil || reusedAuthString != sshAuthString || len(provisioner.tmpArtifacts.paths) != 1 {
+		test.Errorf("temporary ssh key file was not reused: %s", reusedAuthString)
+	}
+
+	// test temporary ssh key file is removed
+	provisioner.cleanupTmpArtifacts()
+	if _, err = os.Stat(sshAuthString); !errors.Is(err, os.ErrNotExist) {
+		test.Errorf("temporary ssh key file was not removed: %s", sshAuthString)
+	}
+
+	// test invalid private key cannot be loaded into ephemeral agent
+	provisioner.config.SSHEphemeralAgent = true
+	if _, _, err = provisioner.determineSSHAuth(ui); err == nil {
+		test.Error("determineSSHAuth did not fail on loading an invalid ssh private key into an ephemeral agent")
+	}
 
+	// generate valid private key
+	_, rawPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		test.Fatal(err)
+	}
+	pemBlock, err := gossh.MarshalPrivateKey(rawPrivateKey, "")
+	if err != nil {
+		test.Fatal(err)
+	}
+	provisioner.generatedData["SSHPrivateKey"] = string(pem.EncodeToMemory(pemBlock))
+
+	// test successfully loads private key into ephemeral agent
+	sshAuthType, sshAuthString, err = provisioner.determineSSHAuth(ui)
+	if err != nil {
+		test.Errorf("determineSSHAuth failed to load ssh private key into ephemeral agent: %s", err)
+	}
+	if sshAuthType != agent {
+		test.Errorf("ssh authentication type incorrectly determined: %s", sshAuthType)
+	}
+	agentConn, err := net.Dial("unix", sshAuthString)
+	if err != nil {
+		test.Fatalf("ephemeral ssh agent socket is unavailable: %s", err)
+	}
+	if keys, err := sshagent.NewClient(agentConn).List(); err != nil || len(keys) != 1 {
+		test.Errorf("ephemeral ssh agent does not contain the ssh private key: %v", keys)
+	}
+	agentConn.Close()
+
+	// test ephemeral agent is reused instead of started again
+	if _, reusedAuthString, err := provisioner.determineSSHAuth(ui); err != nil || reusedAuthString != sshAuthString {
+		test.Errorf("ephemeral ssh agent was not reused: %s", reusedAuthString)
+	}
+
+	// test ephemeral agent socket is removed
+	provisioner.cleanupTmpArtifacts()
+	if _, err = os.Stat(sshAuthString); !errors.Is(err, os.ErrNotExist) {
+		test.Errorf("ephemeral ssh agent socket was not removed: %s", sshAuthString)
+	}
+
+	// test successfully loads private key and certificate into ephemeral agent
+	provisioner.config.SSHCertificateFile = sshTestCertificate(test, rawPrivateKey)
+	_, sshAuthString, err = provisioner.determineSSHAuth(ui)
+	if err != nil {
+		test.Errorf("determineSSHAuth failed to load ssh private key and certificate into ephemeral agent: %s", err)
+	}
+	agentConn, err = net.Dial("unix", sshAuthString)
+	if err != nil {
+		test.Fatalf("ephemeral ssh agent socket is unavailable: %s", err)
+	}
+	if keys, err := sshagent.NewClient(agentConn).List(); err != nil || len(keys) != 1 || keys[0].Type() != gossh.CertAlgoED25519v01 {
+		test.Errorf("ephemeral ssh agent does not contain the ssh certificate: %v", keys)
+	}
+	agentConn.Close()
+	provisioner.cleanupTmpArtifacts()
+	provisioner.config.SSHCertificateFile = ""
+
+	// test agent socket parameter does not override the private key
+	provisioner.config.SSHEphemeralAgent = false
+	provisioner.config.SSHAgentSocket = "/path/to/agent.sock"
+	sshAuthType, sshAuthString, err = provisioner.determineSSHAuth(ui)
+	if err != nil || sshAuthType != privateKey || sshAuthString == provisioner.config.SSHAgentSocket {
+		test.Errorf("ssh agent socket incorrectly overrode the private key: %s %s %v", sshAuthType, sshAuthString, err)
+	}
+	provisioner.cleanupTmpArtifacts()
+
+	// test agent socket parameter with packer agent auth
+	provisioner.generatedData["SSHAgentAuth"] = true
+	sshAuthType, sshAuthString, err = provisioner.determineSSHAuth(ui)
+	if err != nil || sshAuthType != agent || sshAuthString != provisioner.config.SSHAgentSocket {
+		test.Errorf("ssh agent socket incorrectly determined with agent auth: %s %s %v", sshAuthType, sshAuthString, err)
+	}
+	provisioner.generatedData["SSHAgentAuth"] = false
+
+	// test agent socket parameter without a private key
 	delete(provisioner.generatedData, "SSHPrivateKey")
+	sshAuthType, sshAuthString, err = provisioner.determineSSHAuth(ui)
+	if err != nil || sshAuthType != agent || sshAuthString != provisioner.config.SSHAgentSocket {
+		test.Errorf("ssh agent socket incorrectly determined without private key: %s %s %v", sshAuthType, sshAuthString, err)
+	}
+	provisioner.config = Config{}
+
 	if _, _, err = provisioner.determineSSHAuth(ui); err == nil || err.Error() != "no ssh authentication" {
 		test.Error("sshauth did not fail on no available ssh authentication information")
 	}
@@ -345,6 +919,25 @@ func TestProvisionerDetermineWinRMArgs(test *testing.T) {
 		test.Errorf("actual: %+q, expected: %+q", args, expectedArgs)
 	}
 
+	// test ca bundle is ignored without ssl verification
+	provisioner.config.WinRMCATrustPath = "/path/to/ca.pem"
+	if _, err = provisioner.determineWinRMArgs(ui); err != nil || len(provisioner.commEnv) > 0 {
+		test.Errorf("winrm ca bundle was not ignored without ssl verification: %v", provisioner.commEnv)
+	}
+
+	// test ca bundle with ssl verification
+	provisioner.generatedData["WinRMInsecure"] = false
+	expectedArgs = []string{"?no_ssl=true", "read_timeout_sec=3902"}
+
+	args, err = provisioner.determineWinRMArgs(ui)
+	if err != nil {
+		test.Error(err)
+	}
+	if !slices.Equal(expectedArgs, args) || provisioner.commEnv["REQUESTS_CA_BUNDLE"] != provisioner.config.WinRMCATrustPath {
+		test.Errorf("winrm ca bundle incorrectly determined: %+q %v", args, provisioner.commEnv)
+	}
+	provisioner.config = Config{}
+
 	// test malformed winrmtimeout
 	provisioner.generatedData["WinRMTimeout"], _ = time.ParseDuration("2a5l1z")
 	if _, err = provisioner.determineWinRMArgs(ui); err == nil || err.Error() != "invalid winrmtimeout" {
@@ -0,0 +1,93 @@
+package testinfra
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// environment variable names which likely contain credentials
+var sensitiveEnv = regexp.MustCompile(`(?i)pass|secret|token|credential|key`)
+
+// shell arguments which require no quoting
+var safeArg = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// display the testinfra execution without executing anything
+func (provisioner *Provisioner) dryRun(ui packer.Ui, cmds []*exec.Cmd, localCmd *packer.RemoteCmd) {
+	ui.Say("Testinfra dry run; no tests will be executed")
+
+	// remote execution
+	for _, cmd := range cmds {
+		ui.Sayf("Testinfra command for %s:", displayHosts(cmd.Args))
+		ui.Say(displayCmd(cmd.Args))
+		if len(cmd.Dir) > 0 {
+			ui.Sayf("executed within directory: %s", cmd.Dir)
+		}
+	}
+	if len(cmds) > 0 {
+		if envVars := provisioner.envAdditions(); len(envVars) > 0 {
+			ui.Say("with environment variables in addition to the Packer environment:")
+			for _, envVar := range envVars {
+				ui.Sayf("  %s", redactEnv(envVar))
+			}
+		}
+	}
+
+	// local execution
+	if localCmd != nil {
+		if len(provisioner.config.InstallCmd) > 0 {
+			ui.Sayf("Testinfra installation command on the instance: %s", strings.Join(provisioner.config.InstallCmd, " "))
+		}
+		if len(provisioner.config.DestinationDir) > 0 {
+			var files []string
+			if len(provisioner.config.TestSource) == 0 {
+				files = provisioner.config.TestFiles
+			}
+			provisioner.displayUploadPlan(ui, files)
+		}
+		ui.Say("Testinfra command on the instance:")
+		ui.Say(maskPasswords(localCmd.Command))
+	}
+}
+
+// display the files which would be transferred to the instance
+func (provisioner *Provisioner) displayUploadPlan(ui packer.Ui, files []string) {
+	if len(provisioner.config.ConfigFile) > 0 && len(provisioner.config.TestSource) == 0 {
+		files = append(files, provisioner.config.ConfigFile)
+	}
+	if len(files) == 0 {
+		return
+	}
+
+	ui.Say("files transferred to the instance:")
+	for _, file := range files {
+		ui.Sayf("  %s -> %s/%s", file, provisioner.config.DestinationDir, relativePath(file, provisioner.testFileRoots))
+	}
+}
+
+// helper function to display command arguments as a shell command with passwords masked
+func displayCmd(args []string) string {
+	displayArgs := make([]string, 0, len(args))
+	for _, arg := range args {
+		if !safeArg.MatchString(arg) {
+			arg = shellQuote(arg)
+		}
+		displayArgs = append(displayArgs, maskPasswords(arg))
+	}
+
+	return strings.Join(displayArgs, " ")
+}
+
+// helper function to redact the value of an environment variable which likely contains credentials
+func redactEnv(envVar string) string {
+	key, value, _ := strings.Cut(envVar, "=")
+	if sensitiveEnv.MatchString(key) {
+		return fmt.Sprintf("%s=****", key)
+	}
+
+	// uris such as DOCKER_HOST may also contain credentials
+	return fmt.Sprintf("%s=%s", key, maskPasswords(value))
+}
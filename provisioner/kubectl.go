@@ -0,0 +1,35 @@
+package testinfra
+
+import (
+	"log"
+)
+
+// determine and return testinfra pod backend options for the context, namespace, container, and kubeconfig
+func (provisioner *Provisioner) kubectlOptions(connectionType connectionType) map[string]string {
+	options := map[string]string{}
+
+	if len(provisioner.config.Kubeconfig) > 0 {
+		options["kubeconfig"] = provisioner.config.Kubeconfig
+	}
+	// openshift backend does not support context
+	if len(provisioner.config.KubectlContext) > 0 {
+		if connectionType == kubectl {
+			options["context"] = provisioner.config.KubectlContext
+		} else {
+			log.Printf("kubectl context is unsupported with the %s connection backend, and will be ignored", connectionType)
+		}
+	}
+	if len(provisioner.config.KubectlNamespace) > 0 {
+		options["namespace"] = provisioner.config.KubectlNamespace
+	}
+	if len(provisioner.config.KubectlContainer) > 0 {
+		options["container"] = provisioner.config.KubectlContainer
+	}
+
+	// backend options are appended separately (and validated as consistent with these parameters)
+	for key := range provisioner.config.BackendOptions {
+		delete(options, key)
+	}
+
+	return options
+}
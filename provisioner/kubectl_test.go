@@ -0,0 +1,22 @@
+package testinfra
+
+import (
+	"testing"
+)
+
+// test provisioner kubectlOptions properly determines testinfra pod backend options
+func TestProvisionerKubectlOptions(test *testing.T) {
+	provisioner := &Provisioner{config: Config{
+		Kubeconfig:       "/path/to/kubeconfig",
+		KubectlContext:   "kind-packer",
+		KubectlNamespace: "test",
+		BackendOptions:   map[string]string{"namespace": "test"},
+	}}
+
+	if options := provisioner.kubectlOptions(kubectl); len(options) != 2 || options["kubeconfig"] != "/path/to/kubeconfig" || options["context"] != "kind-packer" {
+		test.Errorf("kubectl backend options incorrectly determined: %v", options)
+	}
+	if options := provisioner.kubectlOptions(openshift); len(options) != 1 || options["kubeconfig"] != "/path/to/kubeconfig" {
+		test.Errorf("openshift backend options incorrectly determined: %v", options)
+	}
+}
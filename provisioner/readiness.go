@@ -0,0 +1,284 @@
+package testinfra
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	gossh "golang.org/x/crypto/ssh"
+	sshagent "golang.org/x/crypto/ssh/agent"
+	"golang.org/x/net/proxy"
+)
+
+// initial delay between readiness attempts; doubled after each failed attempt up to the maximum
+var (
+	readinessBackoff    = 2 * time.Second
+	readinessMaxBackoff = 30 * time.Second
+	readinessTimeout    = 10 * time.Second
+)
+
+// wait for the packer communicator host to respond prior to testinfra execution
+func (provisioner *Provisioner) awaitReadiness(ctx context.Context, ui packer.Ui) error {
+	// readiness applies only to the packer communicator
+	if len(provisioner.config.Hosts) > 0 && !slices.Contains(provisioner.config.Hosts, packerHost) {
+		log.Print("readiness probe skipped because the hosts parameter does not include the packer communicator")
+		return nil
+	}
+
+	// determine connection type
+	connectionType, err := provisioner.determineConnectionType(ui)
+	if err != nil {
+		return err
+	}
+
+	// determine probe for connection type
+	var probe func() error
+	switch connectionType {
+	case ssh, paramiko:
+		probe, err = provisioner.sshProbe(connectionType, ui)
+	case winrm:
+		probe, err = provisioner.winrmProbe(ui)
+	default:
+		log.Printf("readiness probe is unsupported for the %s connection type and will be skipped", connectionType)
+		return nil
+	}
+	if err != nil {
+		ui.Error("unable to prepare the readiness probe from available Packer data")
+		return err
+	}
+
+	ui.Sayf("verifying %s connectivity with the instance prior to Testinfra execution", connectionType)
+
+	// attempt probe until success or retries are exhausted
+	backoff := readinessBackoff
+	for attempt := 0; ; attempt++ {
+		probeErr := probe()
+		if probeErr == nil {
+			ui.Say("instance is ready for Testinfra execution")
+			return nil
+		}
+
+		if attempt >= provisioner.config.ReadinessRetries {
+			ui.Errorf("the instance did not respond to %s connectivity checks after %d attempts: %s", connectionType, attempt+1, probeErr)
+			return errors.New("instance connectivity failure")
+		}
+
+		log.Printf("readiness probe attempt %d failed with '%s', and will retry in %s", attempt+1, probeErr, backoff)
+
+		// wait for backoff or cancellation
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, readinessMaxBackoff)
+	}
+}
+
+// determine and return ssh readiness probe with the communicator authentication and connection options
+func (provisioner *Provisioner) sshProbe(connectionType connectionType, ui packer.Ui) (func() error, error) {
+	// assign user and host address
+	user, httpAddr, err := provisioner.determineUserAddr(ssh, ui)
+	if err != nil {
+		return nil, err
+	}
+
+	// assign ssh auth type and string (key file path or password)
+	sshAuthType, sshAuthString, err := provisioner.determineSSHAuth(ui)
+	if err != nil {
+		return nil, err
+	}
+
+	// algorithms and proxy consistent with the ssh options for the testinfra ssh backend (unused by the paramiko backend)
+	// keepalive is irrelevant for the short lived probe connection
+	var ciphers, kexAlgos []string
+	var proxyAddr string
+	if connectionType == ssh {
+		ciphers = provisioner.config.SSHCiphers
+		kexAlgos = provisioner.config.SSHKEXAlgos
+		proxyAddr = provisioner.determineSSHProxy()
+	}
+
+	// determine ssh client authentication method
+	var authMethods []gossh.AuthMethod
+	switch sshAuthType {
+	case password:
+		// servers may only permit keyboard-interactive authentication, which prompts for the same password
+		authMethods = []gossh.AuthMethod{
+			gossh.Password(sshAuthString),
+			gossh.KeyboardInteractive(func(_ string, _ string, questions []string, _ []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for index := range answers {
+					answers[index] = sshAuthString
+				}
+				return answers, nil
+			}),
+		}
+	case privateKey:
+		keyBytes, err := os.ReadFile(sshAuthString)
+		if err != nil {
+			ui.Errorf("unable to read ssh private key at: %s", sshAuthString)
+			return nil, err
+		}
+		signer, err := gossh.ParsePrivateKey(keyBytes)
+		if err != nil {
+			// e.g. passphrase protected keys are not parsed, so fallback to connectivity only
+			log.Printf("unable to parse ssh private key for readiness probe, and will verify only tcp connectivity: %s", err)
+			return tcpProbe(httpAddr, proxyAddr), nil
+		}
+		// certificate signer if a certificate accompanies the private key
+		if sshCertificateFile := provisioner.determineSSHCertificate(sshAuthType); len(sshCertificateFile) > 0 {
+			certificate, err := parseSSHCertificate(sshCertificateFile)
+			if err != nil {
+				ui.Errorf("unable to parse ssh certificate at: %s", sshCertificateFile)
+				return nil, err
+			}
+			if signer, err = gossh.NewCertSigner(certificate, signer); err != nil {
+				ui.Error("ssh certificate does not correspond to the ssh private key")
+				return nil, err
+			}
+		}
+		authMethods = []gossh.AuthMethod{gossh.PublicKeys(signer)}
+	case agent:
+		// specific agent socket instead of ambient agent
+		agentSocket := sshAuthString
+		if len(agentSocket) == 0 {
+			agentSocket = os.Getenv("SSH_AUTH_SOCK")
+		}
+
+		return func() error {
+			// agent connection persists only for the probe duration
+			agentConn, err := net.Dial("unix", agentSocket)
+			if err != nil {
+				return err
+			}
+			defer agentConn.Close()
+
+			return dialSSH(httpAddr, proxyAddr, sshClientConfig(user, []gossh.AuthMethod{gossh.PublicKeysCallback(sshagent.NewClient(agentConn).Signers)}, ciphers, kexAlgos))
+		}, nil
+	default:
+		return nil, errors.New("unsupported ssh auth type")
+	}
+
+	clientConfig := sshClientConfig(user, authMethods, ciphers, kexAlgos)
+
+	return func() error {
+		return dialSSH(httpAddr, proxyAddr, clientConfig)
+	}, nil
+}
+
+// return ssh client config with the algorithms and no strict host key checking
+func sshClientConfig(user string, authMethods []gossh.AuthMethod, ciphers []string, kexAlgos []string) *gossh.ClientConfig {
+	return &gossh.ClientConfig{
+		Config:          gossh.Config{Ciphers: ciphers, KeyExchanges: kexAlgos},
+		User:            user,
+		Auth:            authMethods,
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(),
+		Timeout:         readinessTimeout,
+	}
+}
+
+// dial ssh where successful authentication is sufficient for readiness
+func dialSSH(httpAddr string, proxyAddr string, clientConfig *gossh.ClientConfig) error {
+	conn, err := dialTCP(httpAddr, proxyAddr)
+	if err != nil {
+		return err
+	}
+
+	// bound the handshake in addition to the connection
+	if err = conn.SetDeadline(time.Now().Add(readinessTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+	sshConn, channels, requests, err := gossh.NewClientConn(conn, httpAddr, clientConfig)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	// readiness is already established, so close errors are irrelevant
+	gossh.NewClient(sshConn, channels, requests).Close()
+
+	return nil
+}
+
+// dial tcp directly or otherwise through the socks5 proxy
+func dialTCP(httpAddr string, proxyAddr string) (net.Conn, error) {
+	if len(proxyAddr) == 0 {
+		return net.DialTimeout("tcp", httpAddr, readinessTimeout)
+	}
+
+	// testinfra ssh backend proxy command does not authenticate with the proxy
+	dialer, err := proxy.SOCKS5("tcp", proxyAddr, nil, &net.Dialer{Timeout: readinessTimeout})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), readinessTimeout)
+	defer cancel()
+
+	return dialer.(proxy.ContextDialer).DialContext(ctx, "tcp", httpAddr)
+}
+
+// determine and return winrm readiness probe for the communicator listener
+func (provisioner *Provisioner) winrmProbe(ui packer.Ui) (func() error, error) {
+	// assign host address
+	_, httpAddr, err := provisioner.determineUserAddr(winrm, ui)
+	if err != nil {
+		return nil, err
+	}
+
+	// determine scheme and certificate verification consistent with winrm args
+	scheme := "https"
+	if useSSL, ok := provisioner.generatedData["WinRMUseSSL"].(bool); ok && !useSSL {
+		scheme = "http"
+	}
+	insecure, _ := provisioner.generatedData["WinRMInsecure"].(bool)
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecure}
+	if !insecure && len(provisioner.config.WinRMCATrustPath) > 0 {
+		caBundle, err := os.ReadFile(provisioner.config.WinRMCATrustPath)
+		if err != nil {
+			ui.Errorf("winrm ca trust path could not be read: %s", provisioner.config.WinRMCATrustPath)
+			return nil, err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caBundle) {
+			ui.Errorf("winrm ca trust path contains no pem certificates: %s", provisioner.config.WinRMCATrustPath)
+			return nil, errors.New("invalid winrm ca bundle")
+		}
+	}
+
+	client := &http.Client{
+		Timeout:   readinessTimeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	endpoint := fmt.Sprintf("%s://%s/wsman", scheme, httpAddr)
+
+	return func() error {
+		// any http response (normally unauthorized) indicates the listener is ready
+		response, err := client.Post(endpoint, "application/soap+xml;charset=UTF-8", http.NoBody)
+		if err != nil {
+			return err
+		}
+		return response.Body.Close()
+	}, nil
+}
+
+// return tcp connectivity readiness probe
+func tcpProbe(httpAddr string, proxyAddr string) func() error {
+	return func() error {
+		conn, err := dialTCP(httpAddr, proxyAddr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
@@ -0,0 +1,269 @@
+package testinfra
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// helper function to serve ssh password (or only keyboard-interactive) authentication handshakes for readiness testing
+func sshTestServer(test *testing.T, password string, keyboardInteractive bool) (string, int) {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		test.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(hostKey)
+	if err != nil {
+		test.Fatal(err)
+	}
+
+	serverConfig := &gossh.ServerConfig{}
+	if keyboardInteractive {
+		serverConfig.KeyboardInteractiveCallback = func(_ gossh.ConnMetadata, challenge gossh.KeyboardInteractiveChallenge) (*gossh.Permissions, error) {
+			answers, err := challenge("", "", []string{"Password: "}, []bool{false})
+			if err != nil || len(answers) != 1 || answers[0] != password {
+				return nil, gossh.ErrNoAuth
+			}
+			return nil, nil
+		}
+	} else {
+		serverConfig.PasswordCallback = func(_ gossh.ConnMetadata, input []byte) (*gossh.Permissions, error) {
+			if string(input) != password {
+				return nil, gossh.ErrNoAuth
+			}
+			return nil, nil
+		}
+	}
+	serverConfig.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		test.Fatal(err)
+	}
+	test.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if serverConn, _, _, err := gossh.NewServerConn(conn, serverConfig); err == nil {
+					serverConn.Wait()
+				}
+			}()
+		}
+	}()
+
+	address := listener.Addr().(*net.TCPAddr)
+	return address.IP.String(), address.Port
+}
+
+// helper function to serve unauthenticated socks5 connect requests, and return the proxy address and count of proxied connections
+func socksTestProxy(test *testing.T) (string, int, *atomic.Int32) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		test.Fatal(err)
+	}
+	test.Cleanup(func() { listener.Close() })
+
+	var proxied atomic.Int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+
+				// greeting and no authentication method selection
+				greeting := make([]byte, 2)
+				if _, err := io.ReadFull(conn, greeting); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(conn, make([]byte, greeting[1])); err != nil {
+					return
+				}
+				conn.Write([]byte{5, 0})
+
+				// connect request for an ipv4 address
+				request := make([]byte, 10)
+				if _, err := io.ReadFull(conn, request); err != nil || request[3] != 1 {
+					return
+				}
+				target, err := net.Dial("tcp", net.JoinHostPort(net.IP(request[4:8]).String(), strconv.Itoa(int(binary.BigEndian.Uint16(request[8:])))))
+				if err != nil {
+					conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer target.Close()
+				conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				proxied.Add(1)
+
+				go io.Copy(target, conn)
+				io.Copy(conn, target)
+			}()
+		}
+	}()
+
+	address := listener.Addr().(*net.TCPAddr)
+	return address.IP.String(), address.Port, &proxied
+}
+
+// test provisioner awaitReadiness properly probes the communicator
+func TestProvisionerAwaitReadiness(test *testing.T) {
+	ui := packer.TestUi(test)
+	initialBackoff := readinessBackoff
+	test.Cleanup(func() { readinessBackoff = initialBackoff })
+	readinessBackoff = time.Millisecond
+
+	// test ssh password authentication succeeds
+	host, port := sshTestServer(test, "password", false)
+	provisioner := &Provisioner{
+		config: Config{ReadinessRetries: 2},
+		generatedData: map[string]any{
+			"ConnType":    "ssh",
+			"SSHUsername": "me",
+			"SSHPassword": "password",
+			"SSHHost":     host,
+			"SSHPort":     port,
+		},
+	}
+
+	if err := provisioner.awaitReadiness(context.Background(), ui); err != nil {
+		test.Errorf("awaitReadiness function failed with available ssh server: %s", err)
+	}
+
+	// test ssh keyboard-interactive authentication with the password succeeds
+	interactiveHost, interactivePort := sshTestServer(test, "password", true)
+	provisioner.generatedData["SSHHost"], provisioner.generatedData["SSHPort"] = interactiveHost, interactivePort
+	if err := provisioner.awaitReadiness(context.Background(), ui); err != nil {
+		test.Errorf("awaitReadiness function failed with keyboard-interactive ssh server: %s", err)
+	}
+	provisioner.generatedData["SSHHost"], provisioner.generatedData["SSHPort"] = host, port
+
+	// test ssh connection through the socks proxy
+	proxyHost, proxyPort, proxied := socksTestProxy(test)
+	provisioner.config.SSHProxyHost = proxyHost
+	provisioner.config.SSHProxyPort = proxyPort
+	if err := provisioner.awaitReadiness(context.Background(), ui); err != nil || proxied.Load() != 1 {
+		test.Errorf("awaitReadiness function failed to probe the ssh server through the socks proxy: %s", err)
+	}
+
+	// test ssh ciphers are utilized by the probe
+	provisioner.config.SSHCiphers = []string{"unsupported-cipher"}
+	if err := provisioner.awaitReadiness(context.Background(), ui); err == nil {
+		test.Error("awaitReadiness function did not utilize the ssh ciphers")
+	}
+	provisioner.config.SSHCiphers = nil
+
+	// test unreachable socks proxy exhausts retries
+	provisioner.config.SSHProxyPort = 1
+	if err := provisioner.awaitReadiness(context.Background(), ui); err == nil || err.Error() != "instance connectivity failure" {
+		test.Errorf("awaitReadiness function did not connect through the socks proxy: %s", err)
+	}
+	provisioner.config.SSHProxyHost = ""
+	provisioner.config.SSHProxyPort = 0
+
+	// test ssh password authentication rejection exhausts retries
+	provisioner.generatedData["SSHPassword"] = "wrong"
+	if err := provisioner.awaitReadiness(context.Background(), ui); err == nil || err.Error() != "instance connectivity failure" {
+		test.Error("awaitReadiness function did not fail on rejected ssh authentication")
+		test.Error(err)
+	}
+
+	// test winrm listener response succeeds
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		writer.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	winrmHost, winrmPort, _ := net.SplitHostPort(server.Listener.Addr().String())
+	winrmPortInt, _ := strconv.Atoi(winrmPort)
+
+	provisioner.generatedData = map[string]any{
+		"ConnType":    "winrm",
+		"WinRMUser":   "me",
+		"WinRMHost":   winrmHost,
+		"WinRMPort":   winrmPortInt,
+		"WinRMUseSSL": false,
+	}
+
+	if err := provisioner.awaitReadiness(context.Background(), ui); err != nil {
+		test.Errorf("awaitReadiness function failed with available winrm listener: %s", err)
+	}
+
+	// test closed winrm listener exhausts retries
+	server.Close()
+	if err := provisioner.awaitReadiness(context.Background(), ui); err == nil || err.Error() != "instance connectivity failure" {
+		test.Error("awaitReadiness function did not fail on closed winrm listener")
+		test.Error(err)
+	}
+
+	// test winrm https listener verified with ca bundle
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(writer http.ResponseWriter, _ *http.Request) {
+		writer.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer tlsServer.Close()
+	winrmHost, winrmPort, _ = net.SplitHostPort(tlsServer.Listener.Addr().String())
+	winrmPortInt, _ = strconv.Atoi(winrmPort)
+	provisioner.generatedData = map[string]any{
+		"ConnType":  "winrm",
+		"WinRMUser": "me",
+		"WinRMHost": winrmHost,
+		"WinRMPort": winrmPortInt,
+	}
+
+	if err := provisioner.awaitReadiness(context.Background(), ui); err == nil || err.Error() != "instance connectivity failure" {
+		test.Error("awaitReadiness function did not fail on unverified winrm certificate")
+		test.Error(err)
+	}
+
+	provisioner.config.WinRMCATrustPath = filepath.Join(test.TempDir(), "ca.pem")
+	os.WriteFile(provisioner.config.WinRMCATrustPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw}), 0o600)
+	if err := provisioner.awaitReadiness(context.Background(), ui); err != nil {
+		test.Errorf("awaitReadiness function failed with winrm ca bundle: %s", err)
+	}
+
+	os.WriteFile(provisioner.config.WinRMCATrustPath, []byte("foo"), 0o600)
+	if err := provisioner.awaitReadiness(context.Background(), ui); err == nil || err.Error() != "invalid winrm ca bundle" {
+		test.Error("awaitReadiness function did not fail on invalid winrm ca bundle")
+		test.Error(err)
+	}
+	provisioner.config.WinRMCATrustPath = ""
+
+	// test cancellation during backoff
+	readinessBackoff = time.Minute
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := provisioner.awaitReadiness(ctx, ui); err != context.Canceled {
+		test.Errorf("awaitReadiness function did not return cancellation: %s", err)
+	}
+
+	// test unsupported connection type is skipped
+	provisioner.generatedData = map[string]any{
+		"ConnType": "docker",
+		"ID":       "1234567890abcdefg",
+	}
+
+	if err := provisioner.awaitReadiness(context.Background(), ui); err != nil {
+		test.Errorf("awaitReadiness function did not skip docker connection type: %s", err)
+	}
+}
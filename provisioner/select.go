@@ -0,0 +1,129 @@
+package testinfra
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// validate the select rules, and expand their test files
+func (provisioner *Provisioner) prepareSelects() error {
+	for index := range provisioner.config.Selects {
+		rule := &provisioner.config.Selects[index]
+
+		// default name for logging
+		if len(rule.Name) == 0 {
+			rule.Name = fmt.Sprintf("select %d", index+1)
+		}
+
+		// validate match patterns
+		for key, pattern := range rule.Match {
+			if _, err := regexp.Compile(anchorPattern(pattern)); err != nil {
+				log.Printf("the select rule '%s' match pattern for '%s' is not a valid regular expression: %s", rule.Name, key, pattern)
+				return errors.New("invalid select pattern")
+			}
+		}
+
+		// expand select test files (resolved within the test source during provisioning otherwise)
+		if len(rule.TestFiles) > 0 && len(provisioner.config.TestSource) == 0 {
+			testFiles, roots, err := expandTestFiles(rule.TestFiles)
+			if err != nil {
+				return err
+			}
+			rule.TestFiles = testFiles
+
+			if provisioner.testFileRoots == nil {
+				provisioner.testFileRoots = map[string]string{}
+			}
+			maps.Copy(provisioner.testFileRoots, roots)
+		}
+
+		log.Printf("select rule '%s' will select test files '%s' and marker '%s' for builds matching: %v", rule.Name, strings.Join(rule.TestFiles, ", "), rule.Marker, rule.Match)
+	}
+
+	return nil
+}
+
+// return the build facts matched by select rules from the generated data and packer config
+func (provisioner *Provisioner) buildFacts() map[string]string {
+	facts := map[string]string{}
+
+	for key, value := range provisioner.generatedData {
+		facts[key] = fmt.Sprint(value)
+	}
+	facts["PackerBuildName"] = provisioner.config.PackerBuildName
+	// source name is the final component of the build name (e.g. 'ubuntu' for 'amazon-ebs.ubuntu')
+	facts["SourceName"] = provisioner.config.PackerBuildName[strings.LastIndex(provisioner.config.PackerBuildName, ".")+1:]
+	facts["PackerBuilderType"] = provisioner.config.PackerBuilderType
+	for name, value := range provisioner.config.PackerUserVars {
+		facts["var."+name] = value
+	}
+
+	return facts
+}
+
+// apply the test files and marker of the first select rule matching the build
+func (provisioner *Provisioner) applySelect(ui packer.Ui) {
+	facts := provisioner.buildFacts()
+
+	for _, rule := range provisioner.config.Selects {
+		// a nonexistent fact is likely a typo, and never matches
+		for _, key := range slices.Sorted(maps.Keys(rule.Match)) {
+			if _, ok := facts[key]; !ok {
+				ui.Sayf("Warning: select rule '%s' matches the build fact '%s' which does not exist for this build", rule.Name, key)
+			}
+		}
+
+		if !matchSelect(rule.Match, facts) {
+			continue
+		}
+
+		ui.Sayf("select rule '%s' matched the build", rule.Name)
+		provisioner.config = selectConfig(provisioner.config, rule)
+		log.Printf("select rule '%s' selected test files '%s' and marker '%s'", rule.Name, strings.Join(provisioner.config.TestFiles, ", "), provisioner.config.Marker)
+		return
+	}
+
+	ui.Say("no select rule matched the build, and the provisioner test files and marker will be used")
+}
+
+// return the config with the test files and marker of the select rule overriding the provisioner settings
+func selectConfig(baseConfig Config, rule Select) Config {
+	config := baseConfig
+
+	if len(rule.TestFiles) > 0 {
+		config.TestFiles = rule.TestFiles
+	}
+	if len(rule.Marker) > 0 {
+		config.Marker = rule.Marker
+	}
+
+	return config
+}
+
+// helper function to determine whether every match pattern matches its build fact
+func matchSelect(match map[string]string, facts map[string]string) bool {
+	// deterministic evaluation order
+	for _, key := range slices.Sorted(maps.Keys(match)) {
+		value, ok := facts[key]
+		if !ok {
+			return false
+		}
+		if matched, err := regexp.MatchString(anchorPattern(match[key]), value); err != nil || !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// helper function to anchor a pattern to match the entire value
+func anchorPattern(pattern string) string {
+	return fmt.Sprintf("^(?:%s)$", pattern)
+}
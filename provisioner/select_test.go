@@ -0,0 +1,111 @@
+package testinfra
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// test provisioner prepareSelects validates and expands select rules
+func TestProvisionerPrepareSelects(test *testing.T) {
+	provisioner := &Provisioner{
+		config: Config{
+			Selects: []Select{
+				{Match: map[string]string{"ConnType": "winrm"}, TestFiles: []string{"../fixtures/*.py"}},
+				{Name: "linux", Marker: "linux"},
+			},
+		},
+	}
+
+	if err := provisioner.prepareSelects(); err != nil {
+		test.Errorf("prepareSelects failed with valid select rules: %s", err)
+	}
+	if rule := provisioner.config.Selects[0]; rule.Name != "select 1" || !slices.Equal(rule.TestFiles, []string{"../fixtures/test.py"}) || provisioner.testFileRoots["../fixtures/test.py"] != "../fixtures" {
+		test.Errorf("select rule was not defaulted and expanded correctly: %+v", rule)
+	}
+
+	provisioner.config.Selects = []Select{{Match: map[string]string{"SourceName": "ubuntu("}}}
+	if err := provisioner.prepareSelects(); err == nil || err.Error() != "invalid select pattern" {
+		test.Error("prepareSelects did not fail on invalid match pattern")
+		test.Error(err)
+	}
+}
+
+// test provisioner applySelect applies the first matching select rule
+func TestProvisionerApplySelect(test *testing.T) {
+	provisioner := &Provisioner{
+		config: Config{
+			PackerConfig: common.PackerConfig{
+				PackerBuildName:   "amazon-ebs.rhel9",
+				PackerBuilderType: "amazon-ebs",
+				PackerUserVars:    map[string]string{"os": "rhel"},
+			},
+			Marker:    "common",
+			TestFiles: []string{"common.py"},
+			Selects: []Select{
+				{Name: "windows", Match: map[string]string{"ConnType": "winrm"}, TestFiles: []string{"windows.py"}},
+				{Name: "rhel", Match: map[string]string{"PackerBuilderType": "amazon-.*", "SourceName": "rhel[0-9]+", "var.os": "rhel|centos"}, Marker: "rhel"},
+				{Name: "fallback", TestFiles: []string{"fallback.py"}},
+			},
+		},
+		generatedData: map[string]any{"ConnType": "ssh"},
+	}
+
+	// test first matching rule applied with partial override
+	provisioner.applySelect(packer.TestUi(test))
+	if provisioner.config.Marker != "rhel" || !slices.Equal(provisioner.config.TestFiles, []string{"common.py"}) {
+		test.Errorf("applySelect did not apply the matching select rule: %s %v", provisioner.config.Marker, provisioner.config.TestFiles)
+	}
+
+	// test no matching rule retains provisioner settings
+	provisioner.config.Marker = "common"
+	provisioner.config.Selects = provisioner.config.Selects[:1]
+	provisioner.applySelect(packer.TestUi(test))
+	if provisioner.config.Marker != "common" || !slices.Equal(provisioner.config.TestFiles, []string{"common.py"}) {
+		test.Errorf("applySelect modified the provisioner settings without a matching select rule: %s %v", provisioner.config.Marker, provisioner.config.TestFiles)
+	}
+
+	// test nonexistent build fact is warned
+	var output bytes.Buffer
+	provisioner.config.Selects = []Select{{Name: "typo", Match: map[string]string{"Sourcename": "rhel9"}}}
+	provisioner.applySelect(&packer.BasicUi{Reader: strings.NewReader(""), Writer: &output, ErrorWriter: &output})
+	if !strings.Contains(output.String(), "Warning: select rule 'typo' matches the build fact 'Sourcename' which does not exist for this build") {
+		test.Errorf("applySelect did not warn on nonexistent build fact: %s", output.String())
+	}
+}
+
+// test provisioner buildFacts determines the source name from the build name
+func TestProvisionerBuildFacts(test *testing.T) {
+	provisioner := &Provisioner{config: Config{PackerConfig: common.PackerConfig{PackerBuildName: "amazon-ebs.ubuntu"}}}
+	if facts := provisioner.buildFacts(); facts["SourceName"] != "ubuntu" || facts["PackerBuildName"] != "amazon-ebs.ubuntu" {
+		test.Errorf("buildFacts incorrectly determined the source name: %v", facts)
+	}
+
+	provisioner.config.PackerBuildName = "ubuntu"
+	if facts := provisioner.buildFacts(); facts["SourceName"] != "ubuntu" {
+		test.Errorf("buildFacts incorrectly determined the source name without a builder type: %v", facts)
+	}
+}
+
+// test matchSelect matches entire build facts
+func TestMatchSelect(test *testing.T) {
+	facts := map[string]string{"SourceName": "ubuntu-22", "ConnType": "ssh"}
+
+	for _, testCase := range []struct {
+		match   map[string]string
+		matched bool
+	}{
+		{map[string]string{}, true},
+		{map[string]string{"SourceName": "ubuntu-.*", "ConnType": "ssh"}, true},
+		{map[string]string{"SourceName": "ubuntu"}, false},
+		{map[string]string{"ConnType": "ssh", "ID": ".*"}, false},
+	} {
+		if matched := matchSelect(testCase.match, facts); matched != testCase.matched {
+			test.Errorf("select match %v incorrectly determined: %t", testCase.match, matched)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package testinfra
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/hashicorp/go-getter/v2"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// fetch the test source and resolve the test files within it
+func (provisioner *Provisioner) fetchTestSource(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	// fetch test source into a temporary directory for this build
+	tmpDir, err := os.MkdirTemp("", "packer-testinfra-source")
+	if err != nil {
+		ui.Error("unable to create temporary directory for the test source")
+		return err
+	}
+	provisioner.trackTmpArtifact(tmpDir)
+	sourceDir := filepath.Join(tmpDir, "source")
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		ui.Error("unable to determine current working directory for the test source")
+		return err
+	}
+
+	ui.Sayf("fetching Testinfra test source: %s", provisioner.config.TestSource)
+	client := &getter.Client{}
+	if _, err = client.Get(ctx, &getter.Request{Src: provisioner.config.TestSource, Dst: sourceDir, Pwd: pwd, GetMode: getter.ModeAny}); err != nil {
+		ui.Errorf("the test source could not be fetched: %s", provisioner.config.TestSource)
+		return err
+	}
+	log.Printf("test source fetched to: %s", sourceDir)
+
+	// resolve test files, and stage test files, within the test source
+	testFiles, roots, err := resolveSourceFiles(sourceDir, provisioner.config.TestFiles)
+	if err != nil {
+		ui.Error("the test files could not be resolved within the test source")
+		return err
+	}
+	provisioner.config.TestFiles = testFiles
+	provisioner.testFileRoots = maps.Clone(provisioner.testFileRoots)
+	if provisioner.testFileRoots == nil {
+		provisioner.testFileRoots = map[string]string{}
+	}
+	maps.Copy(provisioner.testFileRoots, roots)
+
+	provisioner.config.Stages = slices.Clone(provisioner.config.Stages)
+	for index, stage := range provisioner.config.Stages {
+		if len(stage.TestFiles) > 0 {
+			stageFiles, stageRoots, err := resolveSourceFiles(sourceDir, stage.TestFiles)
+			if err != nil {
+				ui.Errorf("the test files for stage '%s' could not be resolved within the test source", stage.Name)
+				return err
+			}
+			provisioner.config.Stages[index].TestFiles = stageFiles
+			maps.Copy(provisioner.testFileRoots, stageRoots)
+		}
+	}
+
+	// determine the entire test source to preserve supporting files such as conftest.py
+	var sourceFiles []string
+	sourceRoots := map[string]string{}
+	walkErr := filepath.WalkDir(sourceDir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if entry.Type().IsRegular() {
+			sourceFiles = append(sourceFiles, file)
+			sourceRoots[file] = sourceDir
+		}
+		return nil
+	})
+	if walkErr != nil {
+		ui.Error("the test source files could not be determined")
+		return walkErr
+	}
+
+	// verify the test files and their supporting conftest.py modules within the test source
+	if len(provisioner.config.Checksums) > 0 {
+		testFiles := provisioner.allTestFiles()
+		supportFiles, err := supportingFiles(testFiles, provisioner.testFileRoots)
+		if err != nil {
+			ui.Error("the supporting conftest.py modules within the test source could not be determined")
+			return err
+		}
+		if err = verifyChecksums(slices.Concat(testFiles, supportFiles), provisioner.config.Checksums, sourceDir); err != nil {
+			ui.Error("the test files within the test source could not be verified against the checksums")
+			return err
+		}
+		ui.Say("the test files within the test source were verified against the checksums")
+	}
+
+	if provisioner.config.Local {
+		// upload the entire test source
+		if provisioner.config.DryRun {
+			ui.Say("test source files transferred to the instance:")
+			for _, file := range sourceFiles {
+				ui.Sayf("  %s -> %s/%s", file, provisioner.config.DestinationDir, relativePath(file, sourceRoots))
+			}
+		} else if err = uploadFiles(ctx, comm, sourceFiles, sourceRoots, provisioner.config.DestinationDir); err != nil {
+			ui.Error("the test source could not be transferred to the temporary Packer instance")
+			return err
+		}
+	} else if len(provisioner.config.Chdir) == 0 {
+		// test source is the root for test execution
+		provisioner.config.Chdir = sourceDir
+	}
+
+	return nil
+}
+
+// helper function to resolve test files relative to the test source, and return them with the test source as their root directory
+func resolveSourceFiles(sourceDir string, testFiles []string) ([]string, map[string]string, error) {
+	// default to all tests within the test source
+	if len(testFiles) == 0 {
+		testFiles = []string{"."}
+	}
+
+	sourceFiles := make([]string, 0, len(testFiles))
+	for _, testFile := range testFiles {
+		sourceFiles = append(sourceFiles, filepath.Join(sourceDir, testFile))
+	}
+
+	files, _, err := expandTestFiles(sourceFiles)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// structure is preserved relative to the test source
+	roots := make(map[string]string, len(files))
+	for _, file := range files {
+		roots[file] = sourceDir
+	}
+
+	return files, roots, nil
+}
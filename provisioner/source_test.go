@@ -0,0 +1,169 @@
+package testinfra
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// dummy up a test suite in a directory
+func testSuite(test *testing.T) (string, map[string]string) {
+	suite := map[string]string{
+		"README.md":            "# tests\n",
+		"conftest.py":          "import pytest\n",
+		"tests/test_a.py":      "def test_a(host):\n    pass\n",
+		"tests/unit/test_b.py": "def test_b(host):\n    pass\n",
+	}
+
+	dir := test.TempDir()
+	for file, content := range suite {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0o700); err != nil {
+			test.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0o600); err != nil {
+			test.Fatal(err)
+		}
+	}
+
+	return dir, suite
+}
+
+// test fetchTestSource fetches from a local bare git repository
+func TestProvisionerFetchTestSourceGit(test *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		test.Skip("git is not installed")
+	}
+
+	// dummy up a bare git repository with a tagged test suite
+	dir, suite := testSuite(test)
+	bareDir := filepath.Join(test.TempDir(), "suite.git")
+	for _, args := range [][]string{
+		{"-C", dir, "init", "--quiet"},
+		{"-C", dir, "add", "."},
+		{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "suite"},
+		{"-C", dir, "tag", "v1"},
+		{"clone", "--quiet", "--bare", dir, bareDir},
+	} {
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			test.Fatalf("git %s failed: %s", strings.Join(args, " "), output)
+		}
+	}
+
+	// the test files and conftest.py within the test source are verified, but not other files
+	checksums := map[string]string{}
+	for file, content := range suite {
+		if strings.HasSuffix(file, ".py") {
+			checksums[file] = "sha256:" + fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+		}
+	}
+	provisioner := &Provisioner{
+		config: Config{
+			TestSource: "git::file://" + bareDir + "?ref=v1",
+			TestFiles:  []string{"tests/unit"},
+			Checksums:  checksums,
+		},
+	}
+	defer provisioner.cleanupTmpArtifacts()
+
+	if err := provisioner.fetchTestSource(context.Background(), packer.TestUi(test), &packer.MockCommunicator{}); err != nil {
+		test.Fatalf("fetchTestSource failed to fetch git repository: %s", err)
+	}
+
+	// test files resolved within the test source, which is the execution root
+	sourceDir := provisioner.config.Chdir
+	if !strings.HasSuffix(sourceDir, "source") {
+		test.Errorf("test source was not the execution directory: %s", sourceDir)
+	}
+	if expected := filepath.Join(sourceDir, "tests", "unit", "test_b.py"); !slices.Equal(provisioner.config.TestFiles, []string{expected}) || provisioner.testFileRoots[expected] != sourceDir {
+		test.Errorf("test files incorrectly resolved within git test source: %+q", provisioner.config.TestFiles)
+	}
+	if _, err := os.Stat(filepath.Join(sourceDir, "conftest.py")); err != nil {
+		test.Errorf("git test source was not fetched completely: %s", err)
+	}
+}
+
+// test fetchTestSource fetches and uploads a file:// archive
+func TestProvisionerFetchTestSourceArchive(test *testing.T) {
+	// dummy up a gzipped tarball of a test suite
+	_, suite := testSuite(test)
+	archive := filepath.Join(test.TempDir(), "suite.tar.gz")
+	archiveFile, err := os.Create(archive)
+	if err != nil {
+		test.Fatal(err)
+	}
+	gzipWriter := gzip.NewWriter(archiveFile)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for file, content := range suite {
+		if err = tarWriter.WriteHeader(&tar.Header{Name: file, Mode: 0o600, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			test.Fatal(err)
+		}
+		if _, err = tarWriter.Write([]byte(content)); err != nil {
+			test.Fatal(err)
+		}
+	}
+	tarWriter.Close()
+	gzipWriter.Close()
+	archiveFile.Close()
+
+	// test local execution uploads the test source
+	comm := &packer.MockCommunicator{}
+	provisioner := &Provisioner{
+		config: Config{
+			DestinationDir: "/tmp/tests",
+			Local:          true,
+			PytestPath:     "py.test",
+			TestSource:     "file://" + archive,
+		},
+	}
+	defer provisioner.cleanupTmpArtifacts()
+
+	if err = provisioner.fetchTestSource(context.Background(), packer.TestUi(test), comm); err != nil {
+		test.Fatalf("fetchTestSource failed to fetch archive: %s", err)
+	}
+	if len(provisioner.config.TestFiles) != 2 || len(provisioner.config.Chdir) > 0 {
+		test.Errorf("test files incorrectly resolved within archive test source: %+q", provisioner.config.TestFiles)
+	}
+	if !strings.HasPrefix(comm.UploadPath, "/tmp/tests/") {
+		test.Errorf("archive test source was not uploaded to the destination directory: %s", comm.UploadPath)
+	}
+
+	// test local execution command references the uploaded test files
+	_, localCmd, err := provisioner.determineExecCmd(context.Background(), packer.TestUi(test))
+	if err != nil {
+		test.Errorf("determineExecCmd failed with archive test source: %s", err)
+	}
+	if localCmd == nil || localCmd.Command != "py.test /tmp/tests/tests/test_a.py /tmp/tests/tests/unit/test_b.py" {
+		test.Errorf("local execution command incorrectly references archive test source: %v", localCmd)
+	}
+
+	// test mismatched checksum within test source
+	provisioner.config.TestFiles = nil
+	provisioner.config.Checksums = map[string]string{"conftest.py": strings.Repeat("0", 64), "tests/test_a.py": strings.Repeat("0", 64), "tests/unit/test_b.py": strings.Repeat("0", 64)}
+	if err = provisioner.fetchTestSource(context.Background(), packer.TestUi(test), comm); err == nil || err.Error() != "test file checksum mismatch" {
+		test.Errorf("fetchTestSource did not fail on mismatched checksum: %v", err)
+	}
+
+	// test supporting conftest.py without checksum within test source
+	provisioner.config.TestFiles = nil
+	provisioner.config.Checksums = map[string]string{"tests/test_a.py": fmt.Sprintf("%x", sha256.Sum256([]byte(suite["tests/test_a.py"]))), "tests/unit/test_b.py": fmt.Sprintf("%x", sha256.Sum256([]byte(suite["tests/unit/test_b.py"])))}
+	if err = provisioner.fetchTestSource(context.Background(), packer.TestUi(test), comm); err == nil || err.Error() != "missing test file checksum" {
+		test.Errorf("fetchTestSource did not fail on supporting file without checksum: %v", err)
+	}
+	provisioner.config.Checksums = nil
+
+	// test nonexistent test source
+	provisioner.config.TestSource = "file://" + filepath.Join(test.TempDir(), "nonexistent.tar.gz")
+	if err = provisioner.fetchTestSource(context.Background(), packer.TestUi(test), comm); err == nil {
+		test.Error("fetchTestSource did not fail on nonexistent test source")
+	}
+}
@@ -0,0 +1,186 @@
+package testinfra
+
+import (
+	"context"
+	"errors"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// stage result for the combined report
+type stageResult string
+
+const (
+	stagePassed  stageResult = "passed"
+	stageFailed  stageResult = "failed"
+	stageSkipped stageResult = "skipped"
+	stageDryRun  stageResult = "dry run"
+)
+
+// validate stage blocks and expand their test files
+func (provisioner *Provisioner) prepareStages() error {
+	names := make([]string, 0, len(provisioner.config.Stages))
+
+	for index := range provisioner.config.Stages {
+		stage := &provisioner.config.Stages[index]
+
+		// validate unique name
+		if len(stage.Name) == 0 || slices.Contains(names, stage.Name) {
+			log.Printf("the stage at index %d has an empty or duplicate name: '%s'", index, stage.Name)
+			return errors.New("stage name issue")
+		}
+
+		// validate dependencies are earlier stages
+		for _, dependency := range stage.DependsOn {
+			if !slices.Contains(names, dependency) {
+				log.Printf("the stage '%s' depends on '%s' which is not an earlier stage", stage.Name, dependency)
+				return errors.New("invalid stage dependency")
+			}
+		}
+		names = append(names, stage.Name)
+
+		// validate failure policy
+		if len(stage.OnFailure) == 0 {
+			stage.OnFailure = string(abort)
+		} else if _, err := onFailure(stage.OnFailure).New(); err != nil {
+			log.Printf("the stage '%s' on_failure is not a supported policy: %s", stage.Name, stage.OnFailure)
+			return err
+		}
+
+		// expand stage test files (resolved within the test source during provisioning otherwise)
+		if len(stage.TestFiles) > 0 && len(provisioner.config.TestSource) == 0 {
+			testFiles, roots, err := expandTestFiles(stage.TestFiles)
+			if err != nil {
+				return err
+			}
+			stage.TestFiles = testFiles
+
+			if provisioner.testFileRoots == nil {
+				provisioner.testFileRoots = map[string]string{}
+			}
+			maps.Copy(provisioner.testFileRoots, roots)
+		}
+
+		log.Printf("stage '%s' will execute with test files '%s' and on_failure policy '%s'", stage.Name, strings.Join(stage.TestFiles, ", "), stage.OnFailure)
+	}
+
+	return nil
+}
+
+// return the base provisioner config with the stage settings
+func stageConfig(baseConfig Config, stage Stage) Config {
+	config := baseConfig
+
+	// stage settings override the provisioner settings
+	if len(stage.TestFiles) > 0 {
+		config.TestFiles = stage.TestFiles
+	}
+	if len(stage.Marker) > 0 {
+		config.Marker = stage.Marker
+	}
+	if len(stage.Keyword) > 0 {
+		config.Keyword = stage.Keyword
+	}
+	// unset sudo inherits the provisioner sudo, and otherwise enables or disables it
+	if stage.Sudo != nil {
+		config.Sudo = *stage.Sudo
+	}
+	if len(stage.EnvVars) > 0 {
+		config.EnvVars = maps.Clone(baseConfig.EnvVars)
+		if config.EnvVars == nil {
+			config.EnvVars = map[string]string{}
+		}
+		maps.Copy(config.EnvVars, stage.EnvVars)
+	}
+
+	return config
+}
+
+// execute the stages in sequence, and report their combined results
+func (provisioner *Provisioner) executeStages(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	// restore provisioner config after stages
+	baseConfig := provisioner.config
+	defer func() { provisioner.config = baseConfig }()
+
+	results := make(map[string]stageResult, len(baseConfig.Stages))
+	var err error
+	installed := false
+
+	for _, stage := range baseConfig.Stages {
+		// skip stage if any dependency did not pass, or a previous stage aborted
+		if failedDependency := slices.IndexFunc(stage.DependsOn, func(dependency string) bool {
+			return results[dependency] != stagePassed && results[dependency] != stageDryRun
+		}); failedDependency >= 0 || err != nil {
+			ui.Sayf("skipping Testinfra stage %s", stage.Name)
+			results[stage.Name] = stageSkipped
+			continue
+		}
+
+		ui.Sayf("executing Testinfra stage %s", stage.Name)
+		// each stage overrides the base config rather than the previous stage
+		provisioner.config = stageConfig(baseConfig, stage)
+		// install command executes only prior to the first stage
+		if installed {
+			provisioner.config.InstallCmd = nil
+		}
+		installed = true
+
+		if stageErr := provisioner.execute(ctx, ui, comm); stageErr != nil {
+			ui.Errorf("Testinfra stage %s failed", stage.Name)
+			results[stage.Name] = stageFailed
+
+			switch onFailure(stage.OnFailure) {
+			case abort:
+				err = stageErr
+			case proceed:
+				log.Printf("remaining stages will execute after stage '%s' failure", stage.Name)
+			case ignore:
+				log.Printf("stage '%s' failure will not fail the provisioner", stage.Name)
+			}
+			continue
+		}
+
+		if provisioner.config.DryRun {
+			results[stage.Name] = stageDryRun
+		} else {
+			results[stage.Name] = stagePassed
+		}
+	}
+
+	// combined report
+	ui.Say("Testinfra stage results:")
+	failed := false
+	for _, stage := range baseConfig.Stages {
+		ui.Sayf("  %s: %s", stage.Name, results[stage.Name])
+		if results[stage.Name] == stageFailed && onFailure(stage.OnFailure) != ignore {
+			failed = true
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+	if failed {
+		return errors.New("testinfra stage failure")
+	}
+
+	return nil
+}
+
+// return the unique test files of the provisioner and all stages
+func (provisioner *Provisioner) allTestFiles() []string {
+	testFiles := slices.Clone(provisioner.config.TestFiles)
+	for _, stage := range provisioner.config.Stages {
+		for _, testFile := range stage.TestFiles {
+			if !slices.Contains(testFiles, testFile) {
+				testFiles = append(testFiles, testFile)
+			}
+		}
+	}
+
+	return testFiles
+}
@@ -0,0 +1,112 @@
+package testinfra
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// test provisioner prepareStages properly validates stages
+func TestProvisionerPrepareStages(test *testing.T) {
+	provisioner := &Provisioner{config: Config{Stages: []Stage{
+		{Name: "smoke", TestFiles: []string{"../fixtures/*.py"}},
+		{Name: "hardening", DependsOn: []string{"smoke"}, OnFailure: "continue"},
+	}}}
+
+	if err := provisioner.prepareStages(); err != nil {
+		test.Errorf("prepareStages function failed with valid stages: %s", err)
+	}
+	if provisioner.config.Stages[0].OnFailure != string(abort) || !slices.Equal(provisioner.config.Stages[0].TestFiles, []string{"../fixtures/test.py"}) {
+		test.Errorf("stage defaults or test files incorrectly determined: %+v", provisioner.config.Stages[0])
+	}
+
+	// test invalid stages
+	for _, testCase := range []struct {
+		stages []Stage
+		err    string
+	}{
+		{[]Stage{{Name: "smoke"}, {Name: "smoke"}}, "stage name issue"},
+		{[]Stage{{}}, "stage name issue"},
+		{[]Stage{{Name: "smoke", DependsOn: []string{"hardening"}}, {Name: "hardening"}}, "invalid stage dependency"},
+		{[]Stage{{Name: "smoke", OnFailure: "foo"}}, "invalid onFailure enum"},
+	} {
+		provisioner.config.Stages = testCase.stages
+		if err := provisioner.prepareStages(); err == nil || err.Error() != testCase.err {
+			test.Errorf("prepareStages function did not fail with %s: %v", testCase.err, err)
+		}
+	}
+}
+
+// test stageConfig properly overrides provisioner settings
+func TestProvisionerStageConfig(test *testing.T) {
+	provisioner := &Provisioner{config: Config{
+		TestFiles: []string{"test.py"},
+		Marker:    "base",
+		EnvVars:   map[string]string{"A": "1", "B": "1"},
+	}}
+
+	sudo := true
+	config := stageConfig(provisioner.config, Stage{Name: "hardening", Marker: "hardening", Sudo: &sudo, EnvVars: map[string]string{"B": "2"}})
+	if !slices.Equal(config.TestFiles, []string{"test.py"}) || config.Marker != "hardening" || !config.Sudo || config.EnvVars["A"] != "1" || config.EnvVars["B"] != "2" {
+		test.Errorf("stage config incorrectly determined: %+v", config)
+	}
+	if provisioner.config.EnvVars["B"] != "1" {
+		test.Error("stage config modified the provisioner env vars")
+	}
+
+	// test stage sudo disables and inherits the provisioner sudo
+	provisioner.config.Sudo = true
+	noSudo := false
+	if config = stageConfig(provisioner.config, Stage{Name: "unprivileged", Sudo: &noSudo}); config.Sudo {
+		test.Error("stage config did not disable the provisioner sudo")
+	}
+	if config = stageConfig(provisioner.config, Stage{Name: "inherited"}); !config.Sudo {
+		test.Error("stage config did not inherit the provisioner sudo")
+	}
+}
+
+// test provisioner executeStages executes stages with dependencies and failure policies
+func TestProvisionerExecuteStages(test *testing.T) {
+	ui := packer.TestUi(test)
+
+	// fake pytest which fails with the failing marker
+	pytest := filepath.Join(test.TempDir(), "py.test")
+	os.WriteFile(pytest, []byte("#!/bin/sh\ncase \"$*\" in *failing*) exit 1 ;; esac\n"), 0o700)
+
+	provisioner := &Provisioner{
+		config: Config{PytestPath: pytest, Stages: []Stage{
+			{Name: "smoke", OnFailure: "abort"},
+			{Name: "optional", Marker: "failing", OnFailure: "ignore"},
+			{Name: "dependent", DependsOn: []string{"optional"}, OnFailure: "abort"},
+			{Name: "hardening", DependsOn: []string{"smoke"}, Marker: "failing", OnFailure: "continue"},
+			{Name: "final", OnFailure: "abort"},
+		}},
+		generatedData: map[string]any{"ConnType": "docker", "ID": "1234567890abcdefg"},
+	}
+
+	// test continue policy fails after remaining stages
+	if err := provisioner.executeStages(context.Background(), ui, nil); err == nil || err.Error() != "testinfra stage failure" {
+		test.Error("executeStages function did not fail with continued stage failure")
+		test.Error(err)
+	}
+	if provisioner.config.Marker != "" {
+		test.Errorf("provisioner config was not restored after stages: %s", provisioner.config.Marker)
+	}
+
+	// test ignore policy succeeds
+	provisioner.config.Stages[3].OnFailure = "ignore"
+	if err := provisioner.executeStages(context.Background(), ui, nil); err != nil {
+		test.Errorf("executeStages function failed with ignored stage failures: %s", err)
+	}
+
+	// test abort policy fails immediately
+	provisioner.config.Stages[1].OnFailure = "abort"
+	if err := provisioner.executeStages(context.Background(), ui, nil); err == nil || err.Error() == "testinfra stage failure" {
+		test.Error("executeStages function did not fail with aborted stage failure")
+		test.Error(err)
+	}
+}
@@ -1,15 +1,21 @@
-//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config,Select,Stage
 package testinfra
 
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
+	"maps"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
@@ -17,28 +23,90 @@ import (
 
 // config data deserialized/unmarshalled from packer template/config
 type Config struct {
-	Chdir          string            `mapstructure:"chdir" required:"false"`
-	Compact        bool              `mapstructure:"compact" required:"false"`
-	DestinationDir string            `mapstructure:"destination_dir" required:"false"`
-	EnvVars        map[string]string `mapstructure:"env_vars" required:"false"`
-	InstallCmd     []string          `mapstructure:"install_cmd" required:"false"`
-	Keyword        string            `mapstructure:"keyword" required:"false"`
-	Local          bool              `mapstructure:"local" required:"false"`
-	Marker         string            `mapstructure:"marker" required:"false"`
-	Parallel       bool              `mapstructure:"parallel" required:"false"`
-	PytestPath     string            `mapstructure:"pytest_path" required:"false"`
-	Sudo           bool              `mapstructure:"sudo" required:"false"`
-	SudoUser       string            `mapstructure:"sudo_user" required:"false"`
-	TestFiles      []string          `mapstructure:"test_files" required:"false"`
-	Verbose        int               `mapstructure:"verbose" required:"false"`
+	common.PackerConfig `mapstructure:",squash"`
+
+	Backend               string            `mapstructure:"backend" required:"false"`
+	BackendOptions        map[string]string `mapstructure:"backend_options" required:"false"`
+	Chdir                 string            `mapstructure:"chdir" required:"false"`
+	Checksums             map[string]string `mapstructure:"checksums" required:"false"`
+	Compact               bool              `mapstructure:"compact" required:"false"`
+	ConfCutDir            string            `mapstructure:"confcutdir" required:"false"`
+	ConfigFile            string            `mapstructure:"config_file" required:"false"`
+	ContainerHost         string            `mapstructure:"container_host" required:"false"`
+	ContainerUser         string            `mapstructure:"container_user" required:"false"`
+	DestinationDir        string            `mapstructure:"destination_dir" required:"false"`
+	DisablePluginAutoload bool              `mapstructure:"disable_plugin_autoload" required:"false"`
+	DryRun                bool              `mapstructure:"dry_run" required:"false"`
+	EnvVars               map[string]string `mapstructure:"env_vars" required:"false"`
+	Hosts                 []string          `mapstructure:"hosts" required:"false"`
+	HostsParallel         bool              `mapstructure:"hosts_parallel" required:"false"`
+	InstallCmd            []string          `mapstructure:"install_cmd" required:"false"`
+	Keyword               string            `mapstructure:"keyword" required:"false"`
+	Kubeconfig            string            `mapstructure:"kubeconfig" required:"false"`
+	KubectlContainer      string            `mapstructure:"kubectl_container" required:"false"`
+	KubectlContext        string            `mapstructure:"kubectl_context" required:"false"`
+	KubectlNamespace      string            `mapstructure:"kubectl_namespace" required:"false"`
+	Local                 bool              `mapstructure:"local" required:"false"`
+	LXDRemote             string            `mapstructure:"lxd_remote" required:"false"`
+	Marker                string            `mapstructure:"marker" required:"false"`
+	NoTestsCollected      string            `mapstructure:"no_tests_collected" required:"false"`
+	Parallel              bool              `mapstructure:"parallel" required:"false"`
+	PluginsDisable        []string          `mapstructure:"plugins_disable" required:"false"`
+	PluginsEnable         []string          `mapstructure:"plugins_enable" required:"false"`
+	PodmanConnection      string            `mapstructure:"podman_connection" required:"false"`
+	PodmanRootless        bool              `mapstructure:"podman_rootless" required:"false"`
+	PytestPath            string            `mapstructure:"pytest_path" required:"false"`
+	ReadinessRetries      int               `mapstructure:"readiness_retries" required:"false"`
+	RootDir               string            `mapstructure:"rootdir" required:"false"`
+	Selects               []Select          `mapstructure:"select" required:"false"`
+	SkipCollection        bool              `mapstructure:"skip_collection" required:"false"`
+	SSHAgentForwarding    bool              `mapstructure:"ssh_agent_forwarding" required:"false"`
+	SSHAgentSocket        string            `mapstructure:"ssh_agent_socket" required:"false"`
+	SSHCertificateFile    string            `mapstructure:"ssh_certificate_file" required:"false"`
+	SSHCiphers            []string          `mapstructure:"ssh_ciphers" required:"false"`
+	SSHEphemeralAgent     bool              `mapstructure:"ssh_ephemeral_agent" required:"false"`
+	SSHKeepAliveInterval  time.Duration     `mapstructure:"ssh_keep_alive_interval" required:"false"`
+	SSHKEXAlgos           []string          `mapstructure:"ssh_key_exchange_algorithms" required:"false"`
+	SSHProxyHost          string            `mapstructure:"ssh_proxy_host" required:"false"`
+	SSHProxyPort          int               `mapstructure:"ssh_proxy_port" required:"false"`
+	Stages                []Stage           `mapstructure:"stage" required:"false"`
+	Sudo                  bool              `mapstructure:"sudo" required:"false"`
+	SudoUser              string            `mapstructure:"sudo_user" required:"false"`
+	TestFiles             []string          `mapstructure:"test_files" required:"false"`
+	TestSource            string            `mapstructure:"test_source" required:"false"`
+	Verbose               int               `mapstructure:"verbose" required:"false"`
+	WinRMCATrustPath      string            `mapstructure:"winrm_ca_trust_path" required:"false"`
 
 	ctx interpolate.Context
 }
 
+// rule selecting test files and marker for builds matching generated data or packer config
+type Select struct {
+	Match     map[string]string `mapstructure:"match" required:"false"`
+	Marker    string            `mapstructure:"marker" required:"false"`
+	Name      string            `mapstructure:"name" required:"false"`
+	TestFiles []string          `mapstructure:"test_files" required:"false"`
+}
+
+// named test stage executed in sequence within one provisioner
+type Stage struct {
+	DependsOn []string          `mapstructure:"depends_on" required:"false"`
+	EnvVars   map[string]string `mapstructure:"env_vars" required:"false"`
+	Keyword   string            `mapstructure:"keyword" required:"false"`
+	Marker    string            `mapstructure:"marker" required:"false"`
+	Name      string            `mapstructure:"name" required:"true"`
+	OnFailure string            `mapstructure:"on_failure" required:"false"`
+	Sudo      *bool             `mapstructure:"sudo" required:"false"`
+	TestFiles []string          `mapstructure:"test_files" required:"false"`
+}
+
 // implements the packer.Provisioner interface as testinfra.Provisioner
 type Provisioner struct {
 	config        Config
 	generatedData map[string]any
+	tmpArtifacts  *tmpArtifacts
+	commEnv       map[string]string
+	testFileRoots map[string]string
 }
 
 // implements configspec with hcl2spec helper function
@@ -53,12 +121,29 @@ func (provisioner *Provisioner) Prepare(raws ...any) error {
 		PluginType:         "testinfra",
 		Interpolate:        true,
 		InterpolateContext: &provisioner.config.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			// hosts are rendered with packer generated data during provisioning
+			Exclude: []string{"hosts"},
+		},
 	}, raws...)
 	if err != nil {
 		log.Print("error decoding the supplied Packer config")
 		return err
 	}
 
+	return provisioner.validateConfig()
+}
+
+// prepares the provisioner with a config already decoded and interpolated (e.g. by the post-processor)
+func (provisioner *Provisioner) PrepareConfig(config Config, ctx interpolate.Context) error {
+	provisioner.config = config
+	provisioner.config.ctx = ctx
+
+	return provisioner.validateConfig()
+}
+
+// validates the decoded config and assigns defaults
+func (provisioner *Provisioner) validateConfig() error {
 	// set default executable path for py.test
 	if len(provisioner.config.PytestPath) == 0 {
 		log.Print("setting PytestPath to default 'py.test'")
@@ -104,6 +189,36 @@ func (provisioner *Provisioner) Prepare(raws ...any) error {
 		if len(provisioner.config.EnvVars) > 0 {
 			log.Print("environment variables cannot be set for local execution, and this parameter will be ignored")
 		}
+
+		// connection backend
+		if len(provisioner.config.Backend) > 0 {
+			log.Print("the connection backend cannot be overridden for local execution, and this parameter will be ignored")
+		}
+
+		// hosts
+		if len(provisioner.config.Hosts) > 0 {
+			log.Print("the hosts cannot be overridden for local execution, and this parameter will be ignored")
+		}
+
+		// readiness retries
+		if provisioner.config.ReadinessRetries > 0 {
+			log.Print("the readiness probe does not occur with local execution, and this parameter will be ignored")
+		}
+
+		// ssh client settings
+		if len(provisioner.config.SSHCertificateFile) > 0 || len(provisioner.config.SSHCiphers) > 0 || provisioner.config.SSHKeepAliveInterval != 0 || len(provisioner.config.SSHKEXAlgos) > 0 || len(provisioner.config.SSHProxyHost) > 0 {
+			log.Print("the ssh client settings are unused with local execution, and these parameters will be ignored")
+		}
+
+		// container daemon
+		if len(provisioner.config.ContainerHost) > 0 || len(provisioner.config.PodmanConnection) > 0 || provisioner.config.PodmanRootless {
+			log.Print("the container daemon cannot be selected for local execution, and these parameters will be ignored")
+		}
+
+		// winrm ca bundle
+		if len(provisioner.config.WinRMCATrustPath) > 0 {
+			log.Print("the winrm ca trust path is unused with local execution, and this parameter will be ignored")
+		}
 	} else { // verify testinfra installed
 		// chdir parameter
 		if len(provisioner.config.Chdir) > 0 {
@@ -126,12 +241,188 @@ func (provisioner *Provisioner) Prepare(raws ...any) error {
 			log.Printf("environment variables '%v' will be set for the Testinfra execution", provisioner.config.EnvVars)
 		}
 
+		// hosts parameter
+		if len(provisioner.config.Hosts) > 0 {
+			log.Printf("testinfra will communicate with the following hosts: %s", strings.Join(provisioner.config.Hosts, ", "))
+
+			if len(provisioner.config.Backend) > 0 || len(provisioner.config.BackendOptions) > 0 {
+				log.Print("the 'backend' and 'backend_options' parameters apply only to the 'packer' hosts entry when hosts are specified")
+			}
+
+			// hosts parallel parameter
+			if provisioner.config.HostsParallel {
+				if len(provisioner.config.Hosts) > 1 {
+					log.Print("testinfra will execute separately for each host in parallel")
+				} else {
+					log.Print("the 'hosts_parallel' parameter is ignored with only one host")
+				}
+			}
+		} else if provisioner.config.HostsParallel {
+			log.Print("the 'hosts_parallel' parameter is ignored when hosts are not specified")
+		}
+
+		// container parameters
+		if len(provisioner.config.ContainerHost) > 0 {
+			log.Printf("testinfra will communicate with the container daemon at: %s", provisioner.config.ContainerHost)
+		}
+		if len(provisioner.config.ContainerUser) > 0 {
+			log.Printf("testinfra will execute within the container as user: %s", provisioner.config.ContainerUser)
+		}
+
+		// podman parameters
+		if len(provisioner.config.PodmanConnection) > 0 {
+			if len(provisioner.config.ContainerHost) > 0 {
+				log.Print("the podman_connection and container_host parameters are mutually exclusive")
+				return errors.New("podman connection conflict")
+			}
+			log.Printf("testinfra will communicate with the podman system connection: %s", provisioner.config.PodmanConnection)
+		}
+		if provisioner.config.PodmanRootless {
+			if len(provisioner.config.PodmanConnection) > 0 || len(provisioner.config.ContainerHost) > 0 {
+				log.Print("the podman_rootless parameter is ignored with the podman_connection or container_host parameters")
+			} else {
+				log.Print("testinfra will communicate with the rootless podman service socket")
+			}
+		}
+
+		// lxd remote parameter
+		if len(provisioner.config.LXDRemote) > 0 {
+			log.Printf("testinfra will communicate with the lxd or incus instance on the remote: %s", provisioner.config.LXDRemote)
+		}
+
+		// kubeconfig parameter
+		if len(provisioner.config.Kubeconfig) > 0 {
+			// verify kubeconfig exists and is file
+			if info, err := os.Stat(provisioner.config.Kubeconfig); err != nil || info.IsDir() {
+				log.Printf("the kubeconfig does not exist, is not a file, or cannot be accessed at: %s", provisioner.config.Kubeconfig)
+
+				if err != nil {
+					return err
+				} else {
+					return errors.New("kubeconfig path issue")
+				}
+			}
+			log.Printf("kubectl will utilize the kubeconfig at: %s", provisioner.config.Kubeconfig)
+		}
+
+		// kubectl context, namespace, and container parameters
+		if len(provisioner.config.KubectlContext) > 0 {
+			log.Printf("kubectl will utilize the context: %s", provisioner.config.KubectlContext)
+		}
+		if len(provisioner.config.KubectlNamespace) > 0 {
+			log.Printf("kubectl will utilize the namespace: %s", provisioner.config.KubectlNamespace)
+		}
+		if len(provisioner.config.KubectlContainer) > 0 {
+			log.Printf("testinfra will execute against the pod container: %s", provisioner.config.KubectlContainer)
+		}
+
+		// backend parameter
+		if len(provisioner.config.Backend) > 0 {
+			// validate backend is supported
+			backend, err := connectionType(provisioner.config.Backend).New()
+			if err != nil {
+				log.Printf("the backend is not a supported Testinfra connection backend: %s", provisioner.config.Backend)
+				return err
+			}
+			log.Printf("testinfra will communicate via the %s connection backend instead of the automatically determined Packer communicator", backend)
+		}
+
+		// backend options parameter
+		if len(provisioner.config.BackendOptions) > 0 {
+			// backend options must be consistent with the equivalent kubectl parameters
+			kubectlParams := map[string]string{
+				"container":  provisioner.config.KubectlContainer,
+				"context":    provisioner.config.KubectlContext,
+				"kubeconfig": provisioner.config.Kubeconfig,
+				"namespace":  provisioner.config.KubectlNamespace,
+			}
+			for _, key := range slices.Sorted(maps.Keys(kubectlParams)) {
+				if option, ok := provisioner.config.BackendOptions[key]; ok && len(kubectlParams[key]) > 0 && option != kubectlParams[key] {
+					log.Printf("the '%s' backend option '%s' conflicts with the equivalent kubectl parameter value '%s'", key, option, kubectlParams[key])
+					return errors.New("kubectl backend option conflict")
+				}
+			}
+
+			log.Printf("connection backend options '%v' will be set for the Testinfra execution", provisioner.config.BackendOptions)
+		}
+
+		// ssh client parameters
+		if len(provisioner.config.SSHCertificateFile) > 0 {
+			// verify ssh certificate exists and is file
+			if info, err := os.Stat(provisioner.config.SSHCertificateFile); err != nil || info.IsDir() {
+				log.Printf("the ssh certificate file does not exist, is not a file, or cannot be accessed at: %s", provisioner.config.SSHCertificateFile)
+
+				if err != nil {
+					return err
+				} else {
+					return errors.New("ssh certificate file path issue")
+				}
+			}
+			log.Printf("testinfra ssh connections will utilize the certificate file: %s", provisioner.config.SSHCertificateFile)
+		}
+		if provisioner.config.SSHKeepAliveInterval < 0 {
+			log.Printf("the ssh_keep_alive_interval must not be negative: %s", provisioner.config.SSHKeepAliveInterval)
+			return errors.New("invalid ssh keepalive interval")
+		} else if provisioner.config.SSHKeepAliveInterval > 0 {
+			log.Printf("testinfra ssh connections will send keepalives every %s", provisioner.config.SSHKeepAliveInterval)
+		}
+		if len(provisioner.config.SSHCiphers) > 0 {
+			log.Printf("testinfra ssh connections will utilize the ciphers: %s", strings.Join(provisioner.config.SSHCiphers, ", "))
+		}
+		if len(provisioner.config.SSHKEXAlgos) > 0 {
+			log.Printf("testinfra ssh connections will utilize the key exchange algorithms: %s", strings.Join(provisioner.config.SSHKEXAlgos, ", "))
+		}
+		if len(provisioner.config.SSHProxyHost) > 0 {
+			if provisioner.config.SSHProxyPort == 0 {
+				log.Print("setting SSHProxyPort to default 1080")
+				provisioner.config.SSHProxyPort = 1080
+			}
+			log.Printf("testinfra ssh connections will utilize the socks proxy at: %s:%d", provisioner.config.SSHProxyHost, provisioner.config.SSHProxyPort)
+		} else if provisioner.config.SSHProxyPort != 0 {
+			log.Print("the ssh_proxy_port parameter is ignored without the ssh_proxy_host parameter")
+		}
+
+		// winrm ca trust path parameter
+		if len(provisioner.config.WinRMCATrustPath) > 0 {
+			// verify ca bundle exists and is file
+			if info, err := os.Stat(provisioner.config.WinRMCATrustPath); err != nil || info.IsDir() {
+				log.Printf("the winrm ca trust path does not exist, is not a file, or cannot be accessed at: %s", provisioner.config.WinRMCATrustPath)
+
+				if err != nil {
+					return err
+				} else {
+					return errors.New("winrm ca trust path issue")
+				}
+			}
+			log.Printf("testinfra winrm connections will verify certificates with the ca bundle: %s", provisioner.config.WinRMCATrustPath)
+		}
+
+		// readiness retries parameter
+		if provisioner.config.ReadinessRetries < 0 {
+			log.Print("readiness_retries parameter value was set to a negative value and will therefore be reset to the default value of 0")
+			provisioner.config.ReadinessRetries = 0
+		} else if provisioner.config.ReadinessRetries > 0 {
+			log.Printf("instance connectivity will be verified with up to %d retries prior to Testinfra execution", provisioner.config.ReadinessRetries)
+		}
+
 		log.Print("beginning Testinfra installation verification")
 
-		// initialize testinfra -h command
-		outSlurp, err := exec.Command(provisioner.config.PytestPath, "-h").Output()
+		// initialize testinfra -h command with the plugin arguments so pytest validates the enabled plugins
+		pluginArgs := provisioner.pluginArgs()
+		helpCmd := exec.Command(provisioner.config.PytestPath, append(pluginArgs, "-h")...)
+		if provisioner.config.DisablePluginAutoload {
+			helpCmd.Env = append(os.Environ(), "PYTEST_DISABLE_PLUGIN_AUTOLOAD=1")
+		}
+		outSlurp, err := helpCmd.Output()
 		if err != nil {
 			log.Printf("unable to read stdout from Pytest: %s", err.Error())
+
+			// pytest errors on plugins which cannot be loaded
+			var exitErr *exec.ExitError
+			if len(pluginArgs) > 0 && errors.As(err, &exitErr) {
+				log.Printf("one or more of the Pytest plugins '%s' are not available: %s", strings.Join(pluginArgs, " "), exitErr.Stderr)
+				return errors.New("pytest plugin not found")
+			}
 			return err
 		}
 
@@ -185,6 +476,17 @@ func (provisioner *Provisioner) Prepare(raws ...any) error {
 		log.Printf("executing tests with marker expression: %s", provisioner.config.Marker)
 	}
 
+	// plugin parameters
+	if len(provisioner.config.PluginsEnable) > 0 {
+		log.Printf("pytest will load the plugins: %s", strings.Join(provisioner.config.PluginsEnable, ", "))
+	}
+	if len(provisioner.config.PluginsDisable) > 0 {
+		log.Printf("pytest will not load the plugins: %s", strings.Join(provisioner.config.PluginsDisable, ", "))
+	}
+	if provisioner.config.DisablePluginAutoload {
+		log.Print("pytest plugin autoloading will be disabled, and only the testinfra plugin, the pytest-xdist plugin for parallel execution, and the enabled plugins will be loaded")
+	}
+
 	// sudo and sudo_user parameters
 	if provisioner.config.Sudo {
 		log.Print("testinfra will execute with sudo")
@@ -214,20 +516,193 @@ func (provisioner *Provisioner) Prepare(raws ...any) error {
 	}
 
 	// check if testinfra files are specified as inputs
-	if len(provisioner.config.TestFiles) == 0 {
+	if len(provisioner.config.TestSource) > 0 {
+		// test files are resolved within the fetched test source during provisioning
+		log.Printf("the Testinfra tests will be fetched from the test source: %s", provisioner.config.TestSource)
+		if len(provisioner.config.TestFiles) > 0 {
+			log.Printf("the Testinfra test_files '%s' will be resolved relative to the test source", strings.Join(provisioner.config.TestFiles, ", "))
+		}
+
+		// test source is transferred to the instance
+		if provisioner.config.Local && len(provisioner.config.DestinationDir) == 0 {
+			log.Print("the test_source parameter requires the destination_dir parameter for local execution")
+			return errors.New("missing destination_dir")
+		}
+	} else if len(provisioner.config.TestFiles) == 0 {
 		log.Print("all files prefixed with 'test_' recursively discovered from the current working directory will be considered Testinfra test files")
-	} else { // verify testinfra files exist
-		for _, testFile := range provisioner.config.TestFiles {
-			if info, err := os.Stat(testFile); err != nil || info.IsDir() {
-				log.Printf("the Testinfra test_file does not exist, is not a file, or cannot be accessed at: %s", testFile)
+	} else { // verify testinfra files exist, and expand globs and directories
+		testFiles, roots, err := expandTestFiles(provisioner.config.TestFiles)
+		if err != nil {
+			return err
+		}
+		log.Printf("the Testinfra test_files resolved to: %s", strings.Join(testFiles, ", "))
+
+		provisioner.config.TestFiles = testFiles
+		provisioner.testFileRoots = roots
+	}
 
+	// config file parameter
+	if len(provisioner.config.ConfigFile) > 0 {
+		// verify config file exists and is file
+		if info, err := os.Stat(provisioner.config.ConfigFile); err != nil || info.IsDir() {
+			log.Printf("the pytest config_file does not exist, is not a file, or cannot be accessed at: %s", provisioner.config.ConfigFile)
+
+			if err != nil {
+				return err
+			} else {
+				return errors.New("config file path issue")
+			}
+		}
+		log.Printf("pytest will utilize the configuration file at: %s", provisioner.config.ConfigFile)
+	}
+
+	// rootdir and confcutdir parameters
+	for _, param := range []struct {
+		name string
+		path *string
+	}{{"rootdir", &provisioner.config.RootDir}, {"confcutdir", &provisioner.config.ConfCutDir}} {
+		if len(*param.path) == 0 {
+			continue
+		}
+
+		if provisioner.config.Local {
+			// directory is on the instance, so the value cannot be verified on this device
+			log.Printf("pytest will utilize the %s on the temporary Packer instance: %s", param.name, *param.path)
+		} else if info, err := os.Stat(*param.path); err != nil || !info.IsDir() { // verify directory exists and is directory
+			log.Printf("the pytest %s does not exist, is not a directory, or cannot be accessed at: %s", param.name, *param.path)
+
+			if err != nil {
+				return err
+			} else {
+				return fmt.Errorf("%s path issue", param.name)
+			}
+		} else {
+			log.Printf("pytest will utilize the %s: %s", param.name, *param.path)
+		}
+	}
+
+	if provisioner.config.Local {
+		// config file is transferred with the test files
+		if len(provisioner.config.ConfigFile) > 0 {
+			if len(provisioner.config.DestinationDir) == 0 {
+				log.Print("the config_file parameter requires the destination_dir parameter for local execution")
+				return errors.New("missing destination_dir")
+			}
+			log.Printf("the config_file will be copied to '%s' at the temporary Packer instance", provisioner.config.DestinationDir)
+		}
+	} else {
+		// resolve paths independently of the chdir parameter
+		for _, path := range []*string{&provisioner.config.ConfigFile, &provisioner.config.RootDir, &provisioner.config.ConfCutDir} {
+			if len(*path) > 0 {
+				absPath, err := filepath.Abs(*path)
 				if err != nil {
+					log.Printf("unable to determine absolute path of: %s", *path)
 					return err
-				} else {
-					return errors.New("test file path issue")
 				}
+				*path = absPath
+			}
+		}
+	}
+
+	// stage blocks
+	if err := provisioner.prepareStages(); err != nil {
+		return err
+	}
+
+	// no tests collected parameter
+	if len(provisioner.config.NoTestsCollected) == 0 {
+		log.Print("setting no_tests_collected to default 'error'")
+		provisioner.config.NoTestsCollected = string(fail)
+	} else if _, err := noTestsPolicy(provisioner.config.NoTestsCollected).New(); err != nil {
+		log.Printf("the no_tests_collected is not a supported policy: %s", provisioner.config.NoTestsCollected)
+		return err
+	} else {
+		log.Printf("pytest collecting no tests will be handled as: %s", provisioner.config.NoTestsCollected)
+	}
+
+	// dry run parameter
+	if provisioner.config.DryRun {
+		log.Print("the Testinfra execution will be displayed without executing anything")
+	}
+
+	// select blocks
+	if err := provisioner.prepareSelects(); err != nil {
+		return err
+	}
+
+	// checksums parameter
+	if len(provisioner.config.Checksums) > 0 {
+		var testFiles []string
+		if len(provisioner.config.TestSource) > 0 {
+			log.Print("the test files within the test source will be verified against the checksums relative to the test source after it is fetched")
+		} else {
+			// test files of every select rule are verified since the build is unknown
+			testFiles = provisioner.allTestFiles()
+			for _, rule := range provisioner.config.Selects {
+				for _, testFile := range rule.TestFiles {
+					if !slices.Contains(testFiles, testFile) {
+						testFiles = append(testFiles, testFile)
+					}
+				}
+			}
+			if len(testFiles) == 0 {
+				log.Print("the checksums cannot be verified for test files discovered by pytest, and the test_files parameter is required")
+				return errors.New("no test files for checksums")
 			}
 		}
+
+		// config file is verified on this device regardless of the test source
+		if err := provisioner.verifyTestFiles(testFiles); err != nil {
+			log.Print("the test files, supporting conftest.py modules, and config file could not be verified against the checksums")
+			return err
+		}
+	}
+
+	// validate test suite with pytest collection
+	if provisioner.config.Local {
+		log.Print("test collection validation does not occur with local execution")
+	} else if provisioner.config.SkipCollection {
+		log.Print("test collection validation will be skipped")
+	} else if len(provisioner.config.TestSource) > 0 {
+		log.Print("test collection validation cannot occur prior to fetching the test source, and will be skipped")
+	} else {
+		// collect tests for the provisioner and each select rule since the build is unknown
+		selectNames := []string{"provisioner"}
+		selectConfigs := []Config{provisioner.config}
+		for _, rule := range provisioner.config.Selects {
+			if len(rule.TestFiles) > 0 || len(rule.Marker) > 0 {
+				selectNames = append(selectNames, fmt.Sprintf("select rule '%s'", rule.Name))
+				selectConfigs = append(selectConfigs, selectConfig(provisioner.config, rule))
+			}
+		}
+
+		// collect tests for each stage, or otherwise once
+		var names []string
+		var configs []Config
+		for index, baseConfig := range selectConfigs {
+			if len(baseConfig.Stages) == 0 {
+				names = append(names, selectNames[index])
+				configs = append(configs, baseConfig)
+				continue
+			}
+			for _, stage := range baseConfig.Stages {
+				names = append(names, fmt.Sprintf("stage %s of the %s", stage.Name, selectNames[index]))
+				configs = append(configs, stageConfig(baseConfig, stage))
+			}
+		}
+
+		for index, config := range configs {
+			count, err := provisioner.collectTests(config)
+			if errors.Is(err, errNoTestsCollected) && noTestsPolicy(provisioner.config.NoTestsCollected) == warn {
+				log.Printf("pytest collected no tests for the %s, and this will be a warning", names[index])
+				continue
+			}
+			if err != nil {
+				log.Printf("the Testinfra test suite for the %s could not be collected by pytest", names[index])
+				return err
+			}
+			log.Printf("pytest collected %d tests for the %s", count, names[index])
+		}
 	}
 
 	log.Print("packer plugin testinfra validation complete")
@@ -243,10 +718,70 @@ func (provisioner *Provisioner) Provision(ctx context.Context, ui packer.Ui, com
 	provisioner.generatedData = generatedData
 	provisioner.config.ctx.Data = generatedData
 
-	// prepare testinfra test command
-	cmd, localCmd, err := provisioner.determineExecCmd(ctx, ui)
-	if cmd != nil {
-		log.Printf("complete Testinfra remote command is: %s", cmd.String())
+	// remove temporary artifacts upon completion, failure, or cancellation
+	provisioner.artifacts()
+	stopCleanup := context.AfterFunc(ctx, provisioner.cleanupTmpArtifacts)
+	defer func() {
+		stopCleanup()
+		provisioner.cleanupTmpArtifacts()
+	}()
+
+	// restore the config modified by select rules and the test source afterwards
+	baseConfig, baseRoots := provisioner.config, provisioner.testFileRoots
+	defer func() {
+		provisioner.config = baseConfig
+		provisioner.testFileRoots = baseRoots
+	}()
+
+	// select test files and marker for the build
+	if len(provisioner.config.Selects) > 0 {
+		provisioner.applySelect(ui)
+	}
+
+	// fetch test source for testinfra execution
+	if len(provisioner.config.TestSource) > 0 {
+		if err := provisioner.fetchTestSource(ctx, ui, comm); err != nil {
+			return err
+		}
+	}
+
+	// verify instance readiness prior to remote execution
+	if !provisioner.config.Local && !provisioner.config.DryRun && provisioner.config.ReadinessRetries > 0 {
+		if err := provisioner.awaitReadiness(ctx, ui); err != nil {
+			ui.Error("the instance is not ready for Testinfra execution")
+			return err
+		}
+	}
+
+	// execute testinfra for each stage, or otherwise once
+	var err error
+	if len(provisioner.config.Stages) > 0 {
+		err = provisioner.executeStages(ctx, ui, comm)
+	} else {
+		err = provisioner.execute(ctx, ui, comm)
+	}
+	if err != nil {
+		return err
+	}
+
+	if provisioner.config.DryRun {
+		ui.Say("packer plugin testinfra dry run complete")
+		return nil
+	}
+
+	ui.Say("packer plugin testinfra provisioning complete")
+
+	return nil
+}
+
+// determine and execute the testinfra command(s)
+func (provisioner *Provisioner) execute(ctx context.Context, ui packer.Ui, comm packer.Communicator) error {
+	// prepare testinfra test command(s)
+	cmds, localCmd, err := provisioner.determineExecCmd(ctx, ui)
+	if len(cmds) > 0 {
+		for _, cmd := range cmds {
+			log.Printf("complete Testinfra remote command is: %s", cmd.String())
+		}
 	} else if localCmd != nil {
 		log.Printf("complete Testinfra local command is: %s", localCmd.Command)
 	}
@@ -255,26 +790,56 @@ func (provisioner *Provisioner) Provision(ctx context.Context, ui packer.Ui, com
 		return err
 	}
 
+	// display the execution instead of executing
+	if provisioner.config.DryRun {
+		provisioner.dryRun(ui, cmds, localCmd)
+		return nil
+	}
+
+	// verify the files again immediately prior to execution since they may have changed after validation
+	if len(provisioner.config.Checksums) > 0 {
+		if err = provisioner.verifyTestFiles(provisioner.config.TestFiles); err != nil {
+			ui.Error("the test files, supporting conftest.py modules, and config file could not be verified against the checksums")
+			return err
+		}
+		log.Print("the test files, supporting conftest.py modules, and config file were verified against the checksums prior to execution")
+	}
+
 	// execute testinfra remotely with *exec.Cmd
-	if localCmd == nil && cmd != nil {
-		err = execCmd(cmd, ui)
-	} else if localCmd != nil && cmd == nil {
+	if localCmd == nil && len(cmds) == 1 {
+		err = execCmd(cmds[0], noTestsPolicy(provisioner.config.NoTestsCollected), ui)
+	} else if localCmd == nil && len(cmds) > 1 {
+		// separate execution per host in parallel
+		err = execCmdsParallel(cmds, noTestsPolicy(provisioner.config.NoTestsCollected), ui)
+	} else if localCmd != nil && len(cmds) == 0 {
 		// testinfra local execution
 		if len(provisioner.config.DestinationDir) > 0 {
-			// upload testinfra files to temporary packer instance
-			if err = uploadFiles(comm, provisioner.config.TestFiles, provisioner.config.DestinationDir); err != nil {
-				ui.Error("the test files could not be transferred to the temporary Packer instance")
-				return err
+			// upload testinfra files to temporary packer instance (test source is uploaded when fetched)
+			if len(provisioner.config.TestSource) == 0 {
+				if err = uploadFiles(ctx, comm, provisioner.config.TestFiles, provisioner.testFileRoots, provisioner.config.DestinationDir); err != nil {
+					ui.Error("the test files could not be transferred to the temporary Packer instance")
+					return err
+				}
+			}
+
+			// upload pytest config file next to the testinfra files
+			if len(provisioner.config.ConfigFile) > 0 {
+				if err = uploadFiles(ctx, comm, []string{provisioner.config.ConfigFile}, nil, provisioner.config.DestinationDir); err != nil {
+					ui.Error("the pytest config file could not be transferred to the temporary Packer instance")
+					return err
+				}
 			}
 		}
 
 		// execute testinfra local to instance with packer.RemoteCmd
-		err = packerRemoteCmd(ctx, localCmd, provisioner.config.InstallCmd, comm, ui)
+		err = packerRemoteCmd(ctx, localCmd, provisioner.config.InstallCmd, noTestsPolicy(provisioner.config.NoTestsCollected), comm, ui)
 	} else {
 		// somehow we either returned both commands or neither
 		ui.Error("incorrectly determined Testinfra remote command and command local to instance; please report as bug with any relevant log information")
-		if cmd != nil && localCmd != nil {
-			ui.Errorf("Testinfra remote command: %s", cmd.String())
+		if len(cmds) > 0 && localCmd != nil {
+			for _, cmd := range cmds {
+				ui.Errorf("Testinfra remote command: %s", cmd.String())
+			}
 			ui.Errorf("Testinfra local command: %s", localCmd.Command)
 		}
 		return errors.New("failed pytest command determination")
@@ -284,7 +849,5 @@ func (provisioner *Provisioner) Provision(ctx context.Context, ui packer.Ui, com
 		return err
 	}
 
-	ui.Say("packer plugin testinfra provisioning complete")
-
 	return nil
 }
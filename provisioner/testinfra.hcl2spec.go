@@ -10,20 +10,65 @@ import (
 // FlatConfig is an auto-generated flat version of Config.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatConfig struct {
-	Chdir          *string           `mapstructure:"chdir" required:"false" cty:"chdir" hcl:"chdir"`
-	Compact        *bool             `mapstructure:"compact" required:"false" cty:"compact" hcl:"compact"`
-	DestinationDir *string           `mapstructure:"destination_dir" required:"false" cty:"destination_dir" hcl:"destination_dir"`
-	EnvVars        map[string]string `mapstructure:"env_vars" required:"false" cty:"env_vars" hcl:"env_vars"`
-	InstallCmd     []string          `mapstructure:"install_cmd" required:"false" cty:"install_cmd" hcl:"install_cmd"`
-	Keyword        *string           `mapstructure:"keyword" required:"false" cty:"keyword" hcl:"keyword"`
-	Local          *bool             `mapstructure:"local" required:"false" cty:"local" hcl:"local"`
-	Marker         *string           `mapstructure:"marker" required:"false" cty:"marker" hcl:"marker"`
-	Parallel       *bool             `mapstructure:"parallel" required:"false" cty:"parallel" hcl:"parallel"`
-	PytestPath     *string           `mapstructure:"pytest_path" required:"false" cty:"pytest_path" hcl:"pytest_path"`
-	Sudo           *bool             `mapstructure:"sudo" required:"false" cty:"sudo" hcl:"sudo"`
-	SudoUser       *string           `mapstructure:"sudo_user" required:"false" cty:"sudo_user" hcl:"sudo_user"`
-	TestFiles      []string          `mapstructure:"test_files" required:"false" cty:"test_files" hcl:"test_files"`
-	Verbose        *int              `mapstructure:"verbose" required:"false" cty:"verbose" hcl:"verbose"`
+	PackerBuildName       *string           `mapstructure:"packer_build_name" cty:"packer_build_name" hcl:"packer_build_name"`
+	PackerBuilderType     *string           `mapstructure:"packer_builder_type" cty:"packer_builder_type" hcl:"packer_builder_type"`
+	PackerCoreVersion     *string           `mapstructure:"packer_core_version" cty:"packer_core_version" hcl:"packer_core_version"`
+	PackerDebug           *bool             `mapstructure:"packer_debug" cty:"packer_debug" hcl:"packer_debug"`
+	PackerForce           *bool             `mapstructure:"packer_force" cty:"packer_force" hcl:"packer_force"`
+	PackerOnError         *string           `mapstructure:"packer_on_error" cty:"packer_on_error" hcl:"packer_on_error"`
+	PackerUserVars        map[string]string `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
+	PackerSensitiveVars   []string          `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
+	Backend               *string           `mapstructure:"backend" required:"false" cty:"backend" hcl:"backend"`
+	BackendOptions        map[string]string `mapstructure:"backend_options" required:"false" cty:"backend_options" hcl:"backend_options"`
+	Chdir                 *string           `mapstructure:"chdir" required:"false" cty:"chdir" hcl:"chdir"`
+	Checksums             map[string]string `mapstructure:"checksums" required:"false" cty:"checksums" hcl:"checksums"`
+	Compact               *bool             `mapstructure:"compact" required:"false" cty:"compact" hcl:"compact"`
+	ConfCutDir            *string           `mapstructure:"confcutdir" required:"false" cty:"confcutdir" hcl:"confcutdir"`
+	ConfigFile            *string           `mapstructure:"config_file" required:"false" cty:"config_file" hcl:"config_file"`
+	ContainerHost         *string           `mapstructure:"container_host" required:"false" cty:"container_host" hcl:"container_host"`
+	ContainerUser         *string           `mapstructure:"container_user" required:"false" cty:"container_user" hcl:"container_user"`
+	DestinationDir        *string           `mapstructure:"destination_dir" required:"false" cty:"destination_dir" hcl:"destination_dir"`
+	DisablePluginAutoload *bool             `mapstructure:"disable_plugin_autoload" required:"false" cty:"disable_plugin_autoload" hcl:"disable_plugin_autoload"`
+	DryRun                *bool             `mapstructure:"dry_run" required:"false" cty:"dry_run" hcl:"dry_run"`
+	EnvVars               map[string]string `mapstructure:"env_vars" required:"false" cty:"env_vars" hcl:"env_vars"`
+	Hosts                 []string          `mapstructure:"hosts" required:"false" cty:"hosts" hcl:"hosts"`
+	HostsParallel         *bool             `mapstructure:"hosts_parallel" required:"false" cty:"hosts_parallel" hcl:"hosts_parallel"`
+	InstallCmd            []string          `mapstructure:"install_cmd" required:"false" cty:"install_cmd" hcl:"install_cmd"`
+	Keyword               *string           `mapstructure:"keyword" required:"false" cty:"keyword" hcl:"keyword"`
+	Kubeconfig            *string           `mapstructure:"kubeconfig" required:"false" cty:"kubeconfig" hcl:"kubeconfig"`
+	KubectlContainer      *string           `mapstructure:"kubectl_container" required:"false" cty:"kubectl_container" hcl:"kubectl_container"`
+	KubectlContext        *string           `mapstructure:"kubectl_context" required:"false" cty:"kubectl_context" hcl:"kubectl_context"`
+	KubectlNamespace      *string           `mapstructure:"kubectl_namespace" required:"false" cty:"kubectl_namespace" hcl:"kubectl_namespace"`
+	Local                 *bool             `mapstructure:"local" required:"false" cty:"local" hcl:"local"`
+	LXDRemote             *string           `mapstructure:"lxd_remote" required:"false" cty:"lxd_remote" hcl:"lxd_remote"`
+	Marker                *string           `mapstructure:"marker" required:"false" cty:"marker" hcl:"marker"`
+	NoTestsCollected      *string           `mapstructure:"no_tests_collected" required:"false" cty:"no_tests_collected" hcl:"no_tests_collected"`
+	Parallel              *bool             `mapstructure:"parallel" required:"false" cty:"parallel" hcl:"parallel"`
+	PluginsDisable        []string          `mapstructure:"plugins_disable" required:"false" cty:"plugins_disable" hcl:"plugins_disable"`
+	PluginsEnable         []string          `mapstructure:"plugins_enable" required:"false" cty:"plugins_enable" hcl:"plugins_enable"`
+	PodmanConnection      *string           `mapstructure:"podman_connection" required:"false" cty:"podman_connection" hcl:"podman_connection"`
+	PodmanRootless        *bool             `mapstructure:"podman_rootless" required:"false" cty:"podman_rootless" hcl:"podman_rootless"`
+	PytestPath            *string           `mapstructure:"pytest_path" required:"false" cty:"pytest_path" hcl:"pytest_path"`
+	ReadinessRetries      *int              `mapstructure:"readiness_retries" required:"false" cty:"readiness_retries" hcl:"readiness_retries"`
+	RootDir               *string           `mapstructure:"rootdir" required:"false" cty:"rootdir" hcl:"rootdir"`
+	Selects               []FlatSelect      `mapstructure:"select" required:"false" cty:"select" hcl:"select"`
+	SkipCollection        *bool             `mapstructure:"skip_collection" required:"false" cty:"skip_collection" hcl:"skip_collection"`
+	SSHAgentForwarding    *bool             `mapstructure:"ssh_agent_forwarding" required:"false" cty:"ssh_agent_forwarding" hcl:"ssh_agent_forwarding"`
+	SSHAgentSocket        *string           `mapstructure:"ssh_agent_socket" required:"false" cty:"ssh_agent_socket" hcl:"ssh_agent_socket"`
+	SSHCertificateFile    *string           `mapstructure:"ssh_certificate_file" required:"false" cty:"ssh_certificate_file" hcl:"ssh_certificate_file"`
+	SSHCiphers            []string          `mapstructure:"ssh_ciphers" required:"false" cty:"ssh_ciphers" hcl:"ssh_ciphers"`
+	SSHEphemeralAgent     *bool             `mapstructure:"ssh_ephemeral_agent" required:"false" cty:"ssh_ephemeral_agent" hcl:"ssh_ephemeral_agent"`
+	SSHKeepAliveInterval  *string           `mapstructure:"ssh_keep_alive_interval" required:"false" cty:"ssh_keep_alive_interval" hcl:"ssh_keep_alive_interval"`
+	SSHKEXAlgos           []string          `mapstructure:"ssh_key_exchange_algorithms" required:"false" cty:"ssh_key_exchange_algorithms" hcl:"ssh_key_exchange_algorithms"`
+	SSHProxyHost          *string           `mapstructure:"ssh_proxy_host" required:"false" cty:"ssh_proxy_host" hcl:"ssh_proxy_host"`
+	SSHProxyPort          *int              `mapstructure:"ssh_proxy_port" required:"false" cty:"ssh_proxy_port" hcl:"ssh_proxy_port"`
+	Stages                []FlatStage       `mapstructure:"stage" required:"false" cty:"stage" hcl:"stage"`
+	Sudo                  *bool             `mapstructure:"sudo" required:"false" cty:"sudo" hcl:"sudo"`
+	SudoUser              *string           `mapstructure:"sudo_user" required:"false" cty:"sudo_user" hcl:"sudo_user"`
+	TestFiles             []string          `mapstructure:"test_files" required:"false" cty:"test_files" hcl:"test_files"`
+	TestSource            *string           `mapstructure:"test_source" required:"false" cty:"test_source" hcl:"test_source"`
+	Verbose               *int              `mapstructure:"verbose" required:"false" cty:"verbose" hcl:"verbose"`
+	WinRMCATrustPath      *string           `mapstructure:"winrm_ca_trust_path" required:"false" cty:"winrm_ca_trust_path" hcl:"winrm_ca_trust_path"`
 }
 
 // FlatMapstructure returns a new FlatConfig.
@@ -38,20 +83,131 @@ func (*Config) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec }
 // The decoded values from this spec will then be applied to a FlatConfig.
 func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 	s := map[string]hcldec.Spec{
-		"chdir":           &hcldec.AttrSpec{Name: "chdir", Type: cty.String, Required: false},
-		"compact":         &hcldec.AttrSpec{Name: "compact", Type: cty.Bool, Required: false},
-		"destination_dir": &hcldec.AttrSpec{Name: "destination_dir", Type: cty.String, Required: false},
-		"env_vars":        &hcldec.AttrSpec{Name: "env_vars", Type: cty.Map(cty.String), Required: false},
-		"install_cmd":     &hcldec.AttrSpec{Name: "install_cmd", Type: cty.List(cty.String), Required: false},
-		"keyword":         &hcldec.AttrSpec{Name: "keyword", Type: cty.String, Required: false},
-		"local":           &hcldec.AttrSpec{Name: "local", Type: cty.Bool, Required: false},
-		"marker":          &hcldec.AttrSpec{Name: "marker", Type: cty.String, Required: false},
-		"parallel":        &hcldec.AttrSpec{Name: "parallel", Type: cty.Bool, Required: false},
-		"pytest_path":     &hcldec.AttrSpec{Name: "pytest_path", Type: cty.String, Required: false},
-		"sudo":            &hcldec.AttrSpec{Name: "sudo", Type: cty.Bool, Required: false},
-		"sudo_user":       &hcldec.AttrSpec{Name: "sudo_user", Type: cty.String, Required: false},
-		"test_files":      &hcldec.AttrSpec{Name: "test_files", Type: cty.List(cty.String), Required: false},
-		"verbose":         &hcldec.AttrSpec{Name: "verbose", Type: cty.Number, Required: false},
+		"packer_build_name":           &hcldec.AttrSpec{Name: "packer_build_name", Type: cty.String, Required: false},
+		"packer_builder_type":         &hcldec.AttrSpec{Name: "packer_builder_type", Type: cty.String, Required: false},
+		"packer_core_version":         &hcldec.AttrSpec{Name: "packer_core_version", Type: cty.String, Required: false},
+		"packer_debug":                &hcldec.AttrSpec{Name: "packer_debug", Type: cty.Bool, Required: false},
+		"packer_force":                &hcldec.AttrSpec{Name: "packer_force", Type: cty.Bool, Required: false},
+		"packer_on_error":             &hcldec.AttrSpec{Name: "packer_on_error", Type: cty.String, Required: false},
+		"packer_user_variables":       &hcldec.AttrSpec{Name: "packer_user_variables", Type: cty.Map(cty.String), Required: false},
+		"packer_sensitive_variables":  &hcldec.AttrSpec{Name: "packer_sensitive_variables", Type: cty.List(cty.String), Required: false},
+		"backend":                     &hcldec.AttrSpec{Name: "backend", Type: cty.String, Required: false},
+		"backend_options":             &hcldec.AttrSpec{Name: "backend_options", Type: cty.Map(cty.String), Required: false},
+		"chdir":                       &hcldec.AttrSpec{Name: "chdir", Type: cty.String, Required: false},
+		"checksums":                   &hcldec.AttrSpec{Name: "checksums", Type: cty.Map(cty.String), Required: false},
+		"compact":                     &hcldec.AttrSpec{Name: "compact", Type: cty.Bool, Required: false},
+		"confcutdir":                  &hcldec.AttrSpec{Name: "confcutdir", Type: cty.String, Required: false},
+		"config_file":                 &hcldec.AttrSpec{Name: "config_file", Type: cty.String, Required: false},
+		"container_host":              &hcldec.AttrSpec{Name: "container_host", Type: cty.String, Required: false},
+		"container_user":              &hcldec.AttrSpec{Name: "container_user", Type: cty.String, Required: false},
+		"destination_dir":             &hcldec.AttrSpec{Name: "destination_dir", Type: cty.String, Required: false},
+		"disable_plugin_autoload":     &hcldec.AttrSpec{Name: "disable_plugin_autoload", Type: cty.Bool, Required: false},
+		"dry_run":                     &hcldec.AttrSpec{Name: "dry_run", Type: cty.Bool, Required: false},
+		"env_vars":                    &hcldec.AttrSpec{Name: "env_vars", Type: cty.Map(cty.String), Required: false},
+		"hosts":                       &hcldec.AttrSpec{Name: "hosts", Type: cty.List(cty.String), Required: false},
+		"hosts_parallel":              &hcldec.AttrSpec{Name: "hosts_parallel", Type: cty.Bool, Required: false},
+		"install_cmd":                 &hcldec.AttrSpec{Name: "install_cmd", Type: cty.List(cty.String), Required: false},
+		"keyword":                     &hcldec.AttrSpec{Name: "keyword", Type: cty.String, Required: false},
+		"kubeconfig":                  &hcldec.AttrSpec{Name: "kubeconfig", Type: cty.String, Required: false},
+		"kubectl_container":           &hcldec.AttrSpec{Name: "kubectl_container", Type: cty.String, Required: false},
+		"kubectl_context":             &hcldec.AttrSpec{Name: "kubectl_context", Type: cty.String, Required: false},
+		"kubectl_namespace":           &hcldec.AttrSpec{Name: "kubectl_namespace", Type: cty.String, Required: false},
+		"local":                       &hcldec.AttrSpec{Name: "local", Type: cty.Bool, Required: false},
+		"lxd_remote":                  &hcldec.AttrSpec{Name: "lxd_remote", Type: cty.String, Required: false},
+		"marker":                      &hcldec.AttrSpec{Name: "marker", Type: cty.String, Required: false},
+		"no_tests_collected":          &hcldec.AttrSpec{Name: "no_tests_collected", Type: cty.String, Required: false},
+		"parallel":                    &hcldec.AttrSpec{Name: "parallel", Type: cty.Bool, Required: false},
+		"plugins_disable":             &hcldec.AttrSpec{Name: "plugins_disable", Type: cty.List(cty.String), Required: false},
+		"plugins_enable":              &hcldec.AttrSpec{Name: "plugins_enable", Type: cty.List(cty.String), Required: false},
+		"podman_connection":           &hcldec.AttrSpec{Name: "podman_connection", Type: cty.String, Required: false},
+		"podman_rootless":             &hcldec.AttrSpec{Name: "podman_rootless", Type: cty.Bool, Required: false},
+		"pytest_path":                 &hcldec.AttrSpec{Name: "pytest_path", Type: cty.String, Required: false},
+		"readiness_retries":           &hcldec.AttrSpec{Name: "readiness_retries", Type: cty.Number, Required: false},
+		"rootdir":                     &hcldec.AttrSpec{Name: "rootdir", Type: cty.String, Required: false},
+		"select":                      &hcldec.BlockListSpec{TypeName: "select", Nested: hcldec.ObjectSpec((*FlatSelect)(nil).HCL2Spec())},
+		"skip_collection":             &hcldec.AttrSpec{Name: "skip_collection", Type: cty.Bool, Required: false},
+		"ssh_agent_forwarding":        &hcldec.AttrSpec{Name: "ssh_agent_forwarding", Type: cty.Bool, Required: false},
+		"ssh_agent_socket":            &hcldec.AttrSpec{Name: "ssh_agent_socket", Type: cty.String, Required: false},
+		"ssh_certificate_file":        &hcldec.AttrSpec{Name: "ssh_certificate_file", Type: cty.String, Required: false},
+		"ssh_ciphers":                 &hcldec.AttrSpec{Name: "ssh_ciphers", Type: cty.List(cty.String), Required: false},
+		"ssh_ephemeral_agent":         &hcldec.AttrSpec{Name: "ssh_ephemeral_agent", Type: cty.Bool, Required: false},
+		"ssh_keep_alive_interval":     &hcldec.AttrSpec{Name: "ssh_keep_alive_interval", Type: cty.String, Required: false},
+		"ssh_key_exchange_algorithms": &hcldec.AttrSpec{Name: "ssh_key_exchange_algorithms", Type: cty.List(cty.String), Required: false},
+		"ssh_proxy_host":              &hcldec.AttrSpec{Name: "ssh_proxy_host", Type: cty.String, Required: false},
+		"ssh_proxy_port":              &hcldec.AttrSpec{Name: "ssh_proxy_port", Type: cty.Number, Required: false},
+		"stage":                       &hcldec.BlockListSpec{TypeName: "stage", Nested: hcldec.ObjectSpec((*FlatStage)(nil).HCL2Spec())},
+		"sudo":                        &hcldec.AttrSpec{Name: "sudo", Type: cty.Bool, Required: false},
+		"sudo_user":                   &hcldec.AttrSpec{Name: "sudo_user", Type: cty.String, Required: false},
+		"test_files":                  &hcldec.AttrSpec{Name: "test_files", Type: cty.List(cty.String), Required: false},
+		"test_source":                 &hcldec.AttrSpec{Name: "test_source", Type: cty.String, Required: false},
+		"verbose":                     &hcldec.AttrSpec{Name: "verbose", Type: cty.Number, Required: false},
+		"winrm_ca_trust_path":         &hcldec.AttrSpec{Name: "winrm_ca_trust_path", Type: cty.String, Required: false},
+	}
+	return s
+}
+
+// FlatSelect is an auto-generated flat version of Select.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatSelect struct {
+	Match     map[string]string `mapstructure:"match" required:"false" cty:"match" hcl:"match"`
+	Marker    *string           `mapstructure:"marker" required:"false" cty:"marker" hcl:"marker"`
+	Name      *string           `mapstructure:"name" required:"false" cty:"name" hcl:"name"`
+	TestFiles []string          `mapstructure:"test_files" required:"false" cty:"test_files" hcl:"test_files"`
+}
+
+// FlatMapstructure returns a new FlatSelect.
+// FlatSelect is an auto-generated flat version of Select.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*Select) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatSelect)
+}
+
+// HCL2Spec returns the hcl spec of a Select.
+// This spec is used by HCL to read the fields of Select.
+// The decoded values from this spec will then be applied to a FlatSelect.
+func (*FlatSelect) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"match":      &hcldec.AttrSpec{Name: "match", Type: cty.Map(cty.String), Required: false},
+		"marker":     &hcldec.AttrSpec{Name: "marker", Type: cty.String, Required: false},
+		"name":       &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false},
+		"test_files": &hcldec.AttrSpec{Name: "test_files", Type: cty.List(cty.String), Required: false},
+	}
+	return s
+}
+
+// FlatStage is an auto-generated flat version of Stage.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatStage struct {
+	DependsOn []string          `mapstructure:"depends_on" required:"false" cty:"depends_on" hcl:"depends_on"`
+	EnvVars   map[string]string `mapstructure:"env_vars" required:"false" cty:"env_vars" hcl:"env_vars"`
+	Keyword   *string           `mapstructure:"keyword" required:"false" cty:"keyword" hcl:"keyword"`
+	Marker    *string           `mapstructure:"marker" required:"false" cty:"marker" hcl:"marker"`
+	Name      *string           `mapstructure:"name" required:"true" cty:"name" hcl:"name"`
+	OnFailure *string           `mapstructure:"on_failure" required:"false" cty:"on_failure" hcl:"on_failure"`
+	Sudo      *bool             `mapstructure:"sudo" required:"false" cty:"sudo" hcl:"sudo"`
+	TestFiles []string          `mapstructure:"test_files" required:"false" cty:"test_files" hcl:"test_files"`
+}
+
+// FlatMapstructure returns a new FlatStage.
+// FlatStage is an auto-generated flat version of Stage.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*Stage) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatStage)
+}
+
+// HCL2Spec returns the hcl spec of a Stage.
+// This spec is used by HCL to read the fields of Stage.
+// The decoded values from this spec will then be applied to a FlatStage.
+func (*FlatStage) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"depends_on": &hcldec.AttrSpec{Name: "depends_on", Type: cty.List(cty.String), Required: false},
+		"env_vars":   &hcldec.AttrSpec{Name: "env_vars", Type: cty.Map(cty.String), Required: false},
+		"keyword":    &hcldec.AttrSpec{Name: "keyword", Type: cty.String, Required: false},
+		"marker":     &hcldec.AttrSpec{Name: "marker", Type: cty.String, Required: false},
+		"name":       &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false},
+		"on_failure": &hcldec.AttrSpec{Name: "on_failure", Type: cty.String, Required: false},
+		"sudo":       &hcldec.AttrSpec{Name: "sudo", Type: cty.Bool, Required: false},
+		"test_files": &hcldec.AttrSpec{Name: "test_files", Type: cty.List(cty.String), Required: false},
 	}
 	return s
 }
@@ -1,11 +1,20 @@
 package testinfra
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"maps"
 	"os"
+	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/packer-plugin-sdk/packer"
 )
@@ -196,6 +205,332 @@ func TestProvisionerPrepareNonExistFiles(test *testing.T) {
 		test.Error("prepare function did not fail correctly on nonexistent testfile")
 		test.Error(err)
 	}
+
+	// test nonexistent winrm ca bundle
+	if err := provisioner.Prepare(&Config{PytestPath: "../fixtures/py.test", WinRMCATrustPath: "/home/foo/ca.pem"}); err == nil || !(errors.Is(err, os.ErrNotExist)) {
+		test.Error("prepare function did not fail correctly on nonexistent winrm ca trust path")
+		test.Error(err)
+	}
+}
+
+// test provisioner prepare expands test file globs and directories
+func TestProvisionerPrepareTestFilesExpansion(test *testing.T) {
+	var provisioner Provisioner
+
+	var expansionConfig = &Config{
+		PytestPath: "../fixtures/py.test",
+		TestFiles:  []string{"../fixtures/**/*.py"},
+	}
+
+	if err := provisioner.Prepare(expansionConfig); err != nil {
+		test.Error("prepare function failed with test files glob")
+		test.Error(err)
+	}
+	if !slices.Equal(provisioner.config.TestFiles, []string{"../fixtures/test.py"}) || provisioner.testFileRoots["../fixtures/test.py"] != "../fixtures" {
+		test.Errorf("test files glob incorrectly expanded: %+q", provisioner.config.TestFiles)
+	}
+
+	var emptyPatternConfig = &Config{
+		PytestPath: "../fixtures/py.test",
+		TestFiles:  []string{"../fixtures/*.rb"},
+	}
+
+	if err := provisioner.Prepare(emptyPatternConfig); err == nil || err.Error() != "test files pattern matched nothing" {
+		test.Error("prepare function did not fail correctly on test files glob matching nothing")
+		test.Error(err)
+	}
+}
+
+// test provisioner prepare validates pytest config file, rootdir, and confcutdir
+func TestProvisionerPrepareConfigFile(test *testing.T) {
+	var provisioner Provisioner
+
+	// test config file is directory
+	var dirConfigFileConfig = &Config{
+		PytestPath: "../fixtures/py.test",
+		ConfigFile: "../fixtures",
+	}
+
+	if err := provisioner.Prepare(dirConfigFileConfig); err == nil || err.Error() != "config file path issue" {
+		test.Error("prepare function did not fail correctly on directory config file")
+		test.Error(err)
+	}
+
+	// test rootdir is file
+	var fileRootDirConfig = &Config{
+		PytestPath: "../fixtures/py.test",
+		RootDir:    "../fixtures/test.py",
+	}
+
+	if err := provisioner.Prepare(fileRootDirConfig); err == nil || err.Error() != "rootdir path issue" {
+		test.Error("prepare function did not fail correctly on file rootdir")
+		test.Error(err)
+	}
+
+	// test local execution without destination directory
+	var noDestinationConfig = &Config{
+		PytestPath: "../fixtures/py.test",
+		ConfigFile: "../fixtures/test.py",
+		Local:      true,
+	}
+
+	if err := provisioner.Prepare(noDestinationConfig); err == nil || err.Error() != "missing destination_dir" {
+		test.Error("prepare function did not fail correctly on local config file without destination directory")
+		test.Error(err)
+	}
+
+	// test confcutdir is nonexistent
+	var noConfCutDirConfig = &Config{
+		PytestPath: "../fixtures/py.test",
+		ConfCutDir: "/home/foo/tests",
+	}
+
+	if err := provisioner.Prepare(noConfCutDirConfig); err == nil || !errors.Is(err, os.ErrNotExist) {
+		test.Error("prepare function did not fail correctly on nonexistent confcutdir")
+		test.Error(err)
+	}
+
+	// test local execution does not verify instance rootdir and confcutdir on this device
+	var localRootDirConfig = &Config{
+		PytestPath: "../fixtures/py.test",
+		RootDir:    "/home/foo/tests",
+		ConfCutDir: "/home/foo/tests/unit",
+		Local:      true,
+	}
+
+	provisioner = Provisioner{}
+	if err := provisioner.Prepare(localRootDirConfig); err != nil {
+		test.Error("prepare function verified the instance rootdir and confcutdir with local execution")
+		test.Error(err)
+	}
+	if provisioner.config.RootDir != localRootDirConfig.RootDir || provisioner.config.ConfCutDir != localRootDirConfig.ConfCutDir {
+		test.Errorf("instance rootdir and confcutdir were modified with local execution: %s, %s", provisioner.config.RootDir, provisioner.config.ConfCutDir)
+	}
+
+	// test remote execution resolves absolute paths
+	var remoteConfig = &Config{
+		PytestPath: "../fixtures/py.test",
+		ConfigFile: "../fixtures/test.py",
+		RootDir:    "../fixtures",
+		ConfCutDir: "../fixtures",
+	}
+
+	provisioner = Provisioner{}
+	if err := provisioner.Prepare(remoteConfig); err != nil {
+		test.Error("prepare function failed with valid config file, rootdir, and confcutdir")
+		test.Error(err)
+	}
+	if !filepath.IsAbs(provisioner.config.ConfigFile) || !filepath.IsAbs(provisioner.config.RootDir) || !filepath.IsAbs(provisioner.config.ConfCutDir) {
+		test.Errorf("config file, rootdir, and confcutdir were not resolved to absolute paths: %s, %s, %s", provisioner.config.ConfigFile, provisioner.config.RootDir, provisioner.config.ConfCutDir)
+	}
+}
+
+// test provisioner prepare validates enabled pytest plugins
+func TestProvisionerPreparePlugins(test *testing.T) {
+	var provisioner Provisioner
+
+	var pluginsConfig = &Config{
+		PytestPath:            "../fixtures/py.test",
+		PluginsEnable:         []string{"pytest_html"},
+		PluginsDisable:        []string{"cacheprovider"},
+		DisablePluginAutoload: true,
+	}
+
+	if err := provisioner.Prepare(pluginsConfig); err != nil {
+		test.Error("prepare function failed with available plugins")
+		test.Error(err)
+	}
+
+	var missingPluginConfig = &Config{
+		PytestPath:    "../fixtures/py.test",
+		PluginsEnable: []string{"nonexistent"},
+	}
+
+	if err := provisioner.Prepare(missingPluginConfig); err == nil || err.Error() != "pytest plugin not found" {
+		test.Error("prepare function did not fail correctly on nonexistent plugin")
+		test.Error(err)
+	}
+}
+
+// test provisioner prepare verifies test files against checksums
+func TestProvisionerPrepareChecksums(test *testing.T) {
+	var provisioner Provisioner
+
+	// compute fixture test file digest
+	content, err := os.ReadFile("../fixtures/test.py")
+	if err != nil {
+		test.Fatal(err)
+	}
+	digest := sha256.Sum256(content)
+
+	var checksumsConfig = &Config{
+		PytestPath: "../fixtures/py.test",
+		TestFiles:  []string{"../fixtures/test.py"},
+		Checksums:  map[string]string{"../fixtures/test.py": hex.EncodeToString(digest[:])},
+	}
+
+	if err := provisioner.Prepare(checksumsConfig); err != nil {
+		test.Error("prepare function failed with matching checksums")
+		test.Error(err)
+	}
+
+	var mismatchConfig = &Config{
+		PytestPath: "../fixtures/py.test",
+		TestFiles:  []string{"../fixtures/test.py"},
+		Checksums:  map[string]string{"../fixtures/test.py": strings.Repeat("0", 64)},
+	}
+
+	if err := provisioner.Prepare(mismatchConfig); err == nil || err.Error() != "test file checksum mismatch" {
+		test.Error("prepare function did not fail correctly on mismatched checksum")
+		test.Error(err)
+	}
+
+	// test checksums without test files
+	var noTestFilesConfig = &Config{
+		PytestPath: "../fixtures/py.test",
+		Checksums:  map[string]string{"../fixtures/test.py": hex.EncodeToString(digest[:])},
+	}
+
+	provisioner = Provisioner{}
+	if err := provisioner.Prepare(noTestFilesConfig); err == nil || err.Error() != "no test files for checksums" {
+		test.Error("prepare function did not fail correctly on checksums without test files")
+		test.Error(err)
+	}
+
+	// dummy up test directory with supporting modules and config file
+	root := test.TempDir()
+	checksums := map[string]string{}
+	for _, file := range []string{"conftest.py", "pytest.ini", "tests/test_a.py", "tests/helper.py"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(root, file)), 0o700)
+		os.WriteFile(filepath.Join(root, file), []byte(file), 0o600)
+		fileDigest := sha256.Sum256([]byte(file))
+		checksums[filepath.Join(root, file)] = hex.EncodeToString(fileDigest[:])
+	}
+	var supportingConfig = &Config{
+		PytestPath:     "../fixtures/py.test",
+		ConfigFile:     filepath.Join(root, "pytest.ini"),
+		TestFiles:      []string{root},
+		Checksums:      checksums,
+		SkipCollection: true,
+	}
+
+	provisioner = Provisioner{}
+	if err := provisioner.Prepare(supportingConfig); err != nil {
+		test.Error("prepare function failed with matching checksums for supporting files")
+		test.Error(err)
+	}
+
+	// test each supporting conftest.py and config file requires a checksum
+	for _, file := range []string{"conftest.py", "pytest.ini"} {
+		supportingConfig.Checksums = maps.Clone(checksums)
+		delete(supportingConfig.Checksums, filepath.Join(root, file))
+
+		provisioner = Provisioner{}
+		if err := provisioner.Prepare(supportingConfig); err == nil || err.Error() != "missing test file checksum" {
+			test.Errorf("prepare function did not fail correctly on supporting file without checksum: %s", file)
+			test.Error(err)
+		}
+	}
+
+	// test other modules do not require a checksum
+	supportingConfig.Checksums = maps.Clone(checksums)
+	delete(supportingConfig.Checksums, filepath.Join(root, "tests/helper.py"))
+
+	provisioner = Provisioner{}
+	if err := provisioner.Prepare(supportingConfig); err != nil {
+		test.Error("prepare function failed without checksum for module which is not a test file or conftest.py")
+		test.Error(err)
+	}
+
+	// test files are verified again prior to execution
+	supportingConfig.Local = true
+	supportingConfig.DestinationDir = "/tmp/tests"
+	provisioner = Provisioner{}
+	if err := provisioner.Prepare(supportingConfig); err != nil {
+		test.Error("prepare function failed with matching checksums for local execution")
+		test.Error(err)
+	}
+	os.WriteFile(filepath.Join(root, "tests/test_a.py"), []byte("modified"), 0o600)
+	if err := provisioner.Provision(context.Background(), packer.TestUi(test), &packer.MockCommunicator{}, map[string]any{}); err == nil || err.Error() != "test file checksum mismatch" {
+		test.Error("provision function did not fail correctly on test file modified after validation")
+		test.Error(err)
+	}
+}
+
+// test provisioner prepare validates test suite with pytest collection
+func TestProvisionerPrepareCollection(test *testing.T) {
+	var provisioner Provisioner
+
+	var emptySelectionConfig = &Config{
+		PytestPath: "../fixtures/py.test",
+		Marker:     "nonexistent",
+		TestFiles:  []string{"../fixtures/test.py"},
+	}
+
+	if err := provisioner.Prepare(emptySelectionConfig); err == nil || err.Error() != "no tests collected" {
+		test.Error("prepare function did not fail correctly on empty test selection")
+		test.Error(err)
+	}
+
+	// test empty test selection as warning
+	emptySelectionConfig.NoTestsCollected = "warn"
+	if err := provisioner.Prepare(emptySelectionConfig); err != nil {
+		test.Error("prepare function failed with empty test selection as warning")
+		test.Error(err)
+	}
+
+	// test invalid policy
+	emptySelectionConfig.NoTestsCollected = "foo"
+	if err := provisioner.Prepare(emptySelectionConfig); err == nil || err.Error() != "invalid noTestsPolicy enum" {
+		test.Error("prepare function did not fail correctly on invalid no_tests_collected")
+		test.Error(err)
+	}
+
+	var skipCollectionConfig = &Config{
+		PytestPath:     "../fixtures/py.test",
+		Marker:         "nonexistent",
+		SkipCollection: true,
+	}
+
+	if err := provisioner.Prepare(skipCollectionConfig); err != nil {
+		test.Error("prepare function failed with skipped collection")
+		test.Error(err)
+	}
+
+	// test collection for each stage
+	var stagesConfig = &Config{
+		PytestPath: "../fixtures/py.test",
+		Stages:     []Stage{{Name: "smoke"}, {Name: "slow", Marker: "nonexistent"}},
+	}
+
+	if err := provisioner.Prepare(stagesConfig); err == nil || err.Error() != "no tests collected" {
+		test.Error("prepare function did not fail correctly on empty stage test selection")
+		test.Error(err)
+	}
+
+	// test collection for each select rule
+	var selectsConfig = &Config{
+		PytestPath: "../fixtures/py.test",
+		TestFiles:  []string{"../fixtures/test.py"},
+		Selects:    []Select{{Name: "windows", Match: map[string]string{"ConnType": "winrm"}, Marker: "nonexistent"}},
+	}
+
+	provisioner = Provisioner{}
+	if err := provisioner.Prepare(selectsConfig); err == nil || err.Error() != "no tests collected" {
+		test.Error("prepare function did not fail correctly on empty select rule test selection")
+		test.Error(err)
+	}
+
+	// test collection with unregistered marker for select rule test files
+	unregisteredMarkerFile := filepath.Join(test.TempDir(), "test_unregistered_marker.py")
+	os.WriteFile(unregisteredMarkerFile, nil, 0o600)
+	selectsConfig.Selects = []Select{{Name: "windows", Match: map[string]string{"ConnType": "winrm"}, TestFiles: []string{unregisteredMarkerFile}}}
+
+	provisioner = Provisioner{}
+	if err := provisioner.Prepare(selectsConfig); err == nil || err.Error() != "test collection failure" {
+		test.Error("prepare function did not fail correctly on unregistered marker in select rule test files")
+		test.Error(err)
+	}
 }
 
 // test provisioner prepare reverts value on processes with no xdist
@@ -211,3 +546,198 @@ func TestProvisionerPrepareNoXdist(test *testing.T) {
 		test.Errorf("actual value: %t", provisioner.config.Parallel)
 	}
 }
+
+// test provisioner prepare errors on unsupported backend
+func TestProvisionerPrepareBackend(test *testing.T) {
+	var provisioner Provisioner
+
+	var invalidBackendConfig = &Config{
+		PytestPath: "../fixtures/py.test",
+		Backend:    "foo",
+	}
+
+	if err := provisioner.Prepare(invalidBackendConfig); err == nil || err.Error() != "invalid connection enum" {
+		test.Error("prepare function did not fail correctly on unsupported backend")
+		test.Error(err)
+	}
+
+	var backendConfig = &Config{
+		PytestPath:     "../fixtures/py.test",
+		Backend:        "paramiko",
+		BackendOptions: map[string]string{"timeout": "30"},
+	}
+
+	if err := provisioner.Prepare(backendConfig); err != nil {
+		test.Error("prepare function failed with supported backend")
+		test.Error(err)
+	}
+}
+
+// test provisioner prepare validates container parameters
+func TestProvisionerPrepareContainer(test *testing.T) {
+	var provisioner Provisioner
+
+	var conflictConfig = &Config{
+		PytestPath:       "../fixtures/py.test",
+		ContainerHost:    "ssh://me@192.168.0.1/run/podman/podman.sock",
+		PodmanConnection: "remote",
+	}
+
+	if err := provisioner.Prepare(conflictConfig); err == nil || err.Error() != "podman connection conflict" {
+		test.Error("prepare function did not fail correctly on podman connection and container host")
+		test.Error(err)
+	}
+
+	var containerConfig = &Config{
+		PytestPath:     "../fixtures/py.test",
+		ContainerHost:  "tcp://192.168.0.1:2376",
+		ContainerUser:  "tester",
+		PodmanRootless: true,
+	}
+
+	if err := provisioner.Prepare(containerConfig); err != nil {
+		test.Error("prepare function failed with container parameters")
+		test.Error(err)
+	}
+}
+
+// test provisioner prepare validates kubectl parameters
+func TestProvisionerPrepareKubectl(test *testing.T) {
+	var provisioner Provisioner
+
+	var conflictConfig = &Config{
+		PytestPath:       "../fixtures/py.test",
+		BackendOptions:   map[string]string{"namespace": "other"},
+		KubectlNamespace: "test",
+	}
+
+	if err := provisioner.Prepare(conflictConfig); err == nil || err.Error() != "kubectl backend option conflict" {
+		test.Error("prepare function did not fail correctly on backend options conflicting with kubectl namespace")
+		test.Error(err)
+	}
+
+	var kubeconfigConfig = &Config{
+		PytestPath: "../fixtures/py.test",
+		Kubeconfig: "../fixtures",
+	}
+
+	if err := provisioner.Prepare(kubeconfigConfig); err == nil || err.Error() != "kubeconfig path issue" {
+		test.Error("prepare function did not fail correctly on kubeconfig directory")
+		test.Error(err)
+	}
+
+	provisioner = Provisioner{}
+	var consistentConfig = &Config{
+		PytestPath:       "../fixtures/py.test",
+		BackendOptions:   map[string]string{"namespace": "test"},
+		KubectlNamespace: "test",
+	}
+
+	if err := provisioner.Prepare(consistentConfig); err != nil {
+		test.Error("prepare function failed with backend options consistent with kubectl namespace")
+		test.Error(err)
+	}
+}
+
+// test provisioner prepare defers hosts rendering to provisioning
+func TestProvisionerPrepareHosts(test *testing.T) {
+	var provisioner Provisioner
+
+	var hostsConfig = &Config{
+		PytestPath: "../fixtures/py.test",
+		Hosts:      []string{"ssh://{{ .User }}@{{ .Host }}"},
+	}
+
+	if err := provisioner.Prepare(hostsConfig); err != nil {
+		test.Error("prepare function failed with hosts config")
+		test.Error(err)
+	}
+	if !slices.Equal(provisioner.config.Hosts, hostsConfig.Hosts) {
+		test.Errorf("hosts were rendered during prepare: %+q", provisioner.config.Hosts)
+	}
+}
+
+// test provisioner prepare validates ssh client parameters
+func TestProvisionerPrepareSSH(test *testing.T) {
+	var provisioner Provisioner
+
+	// test template duration and default proxy port
+	if err := provisioner.Prepare(map[string]any{"pytest_path": "../fixtures/py.test", "ssh_keep_alive_interval": "10s", "ssh_proxy_host": "proxy.example.com"}); err != nil {
+		test.Error("prepare function failed with ssh parameters")
+		test.Error(err)
+	}
+	if provisioner.config.SSHKeepAliveInterval != 10*time.Second || provisioner.config.SSHProxyPort != 1080 {
+		test.Errorf("ssh parameters incorrectly decoded or defaulted: %s %d", provisioner.config.SSHKeepAliveInterval, provisioner.config.SSHProxyPort)
+	}
+
+	// test negative keepalive interval
+	provisioner = Provisioner{}
+	if err := provisioner.Prepare(&Config{PytestPath: "../fixtures/py.test", SSHKeepAliveInterval: -1 * time.Second}); err == nil || err.Error() != "invalid ssh keepalive interval" {
+		test.Error("prepare function did not fail correctly on negative ssh keepalive interval")
+		test.Error(err)
+	}
+
+	// test nonexistent ssh certificate file
+	provisioner = Provisioner{}
+	if err := provisioner.Prepare(&Config{PytestPath: "../fixtures/py.test", SSHCertificateFile: "/foo/bar-cert.pub"}); err == nil {
+		test.Error("prepare function did not fail on nonexistent ssh certificate file")
+	}
+
+	// test ssh certificate file accompanies the packer provided private key file
+	_, rawPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		test.Fatal(err)
+	}
+	provisioner = Provisioner{}
+	certificateFile := sshTestCertificate(test, rawPrivateKey)
+	if err := provisioner.Prepare(map[string]any{"pytest_path": "../fixtures/py.test", "ssh_certificate_file": certificateFile}); err != nil {
+		test.Error("prepare function failed with ssh certificate file")
+		test.Error(err)
+	}
+	// only data which packer populates for provisioners
+	provisioner.generatedData = map[string]any{
+		"ConnType":          "ssh",
+		"User":              "me",
+		"Host":              "192.168.0.1",
+		"Port":              22,
+		"SSHPrivateKeyFile": "/path/to/sshprivatekeyfile",
+		"SSHAgentAuth":      false,
+	}
+	communication, err := provisioner.determineCommunication(packer.TestUi(test))
+	if err != nil {
+		test.Errorf("determineCommunication failed with ssh certificate file: %s", err)
+	}
+	if !slices.Contains(communication, fmt.Sprintf("--ssh-extra-args='-o StrictHostKeyChecking=no' '-o CertificateFile=%s'", certificateFile)) {
+		test.Errorf("ssh certificate file was not utilized: %v", communication)
+	}
+}
+
+// test provisioner provision removes temporary artifacts
+func TestProvisionerProvisionCleanup(test *testing.T) {
+	provisioner := &Provisioner{
+		config: Config{PytestPath: "../fixtures/py.test"},
+	}
+	generatedData := map[string]any{
+		"ConnType":      "ssh",
+		"User":          "me",
+		"Host":          "192.168.0.1",
+		"Port":          22,
+		"SSHPrivateKey": "abcdefg12345",
+	}
+
+	if err := provisioner.Provision(context.Background(), packer.TestUi(test), &packer.MockCommunicator{}, generatedData); err != nil {
+		test.Errorf("provision function failed with ssh private key data: %s", err)
+	}
+	if len(provisioner.tmpArtifacts.paths) > 0 {
+		test.Errorf("temporary artifacts remain after provisioning: %+q", provisioner.tmpArtifacts.paths)
+	}
+
+	// test removal after failed provisioning
+	provisioner.config.PytestPath = "false"
+	if err := provisioner.Provision(context.Background(), packer.TestUi(test), &packer.MockCommunicator{}, generatedData); err == nil {
+		test.Error("provision function did not fail with failing pytest")
+	}
+	if len(provisioner.tmpArtifacts.paths) > 0 {
+		test.Errorf("temporary artifacts remain after failed provisioning: %+q", provisioner.tmpArtifacts.paths)
+	}
+}
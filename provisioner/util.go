@@ -2,16 +2,89 @@ package testinfra
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"maps"
 	"os"
+	"path"
 	"path/filepath"
 	"slices"
+	"strings"
+	"sync"
 
 	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/tmp"
 )
 
+// stage failure policy with pseudo-enum
+type onFailure string
+
+const (
+	abort   onFailure = "abort"
+	proceed onFailure = "continue"
+	ignore  onFailure = "ignore"
+)
+
+var onFailures = []onFailure{abort, proceed, ignore}
+
+// stage failure policy conversion
+func (a onFailure) New() (onFailure, error) {
+	if !slices.Contains(onFailures, a) {
+		log.Printf("string %s could not be converted to onFailure enum", a)
+		return "", errors.New("invalid onFailure enum")
+	}
+	return a, nil
+}
+
+// no tests collected policy with pseudo-enum
+type noTestsPolicy string
+
+const (
+	fail noTestsPolicy = "error"
+	warn noTestsPolicy = "warn"
+)
+
+var noTestsPolicies = []noTestsPolicy{fail, warn}
+
+// no tests collected policy conversion
+func (a noTestsPolicy) New() (noTestsPolicy, error) {
+	if !slices.Contains(noTestsPolicies, a) {
+		log.Printf("string %s could not be converted to noTestsPolicy enum", a)
+		return "", errors.New("invalid noTestsPolicy enum")
+	}
+	return a, nil
+}
+
+// pytest exit code errors
+var (
+	errTestsFailed       = errors.New("testinfra tests failed")
+	errInterrupted       = errors.New("testinfra execution interrupted")
+	errInternalError     = errors.New("pytest internal error")
+	errUsageError        = errors.New("pytest usage error")
+	errNoTestsCollected  = errors.New("no tests collected")
+	pytestExitCodeErrors = map[int]error{1: errTestsFailed, 2: errInterrupted, 3: errInternalError, 4: errUsageError, 5: errNoTestsCollected}
+)
+
+// pytest exit code descriptions
+var pytestExitCodeMessages = map[int]string{
+	1: "tests were collected and executed, but some of the tests failed",
+	2: "test execution was interrupted by the user or a keyboard interrupt",
+	3: "an internal error occurred while executing tests",
+	4: "pytest command line usage error, such as an unknown option or marker expression syntax error",
+	5: "no tests were collected, which usually indicates a typo in the marker or keyword expression",
+}
+
+// helper function to interpret a pytest exit code as its description and error; unknown exit codes return a nil error
+func pytestExitError(exitCode int) (string, error) {
+	return pytestExitCodeMessages[exitCode], pytestExitCodeErrors[exitCode]
+}
+
 // ssh auth type with pseudo-enum
 type sshAuth string
 
@@ -36,14 +109,23 @@ func (a sshAuth) New() (sshAuth, error) {
 type connectionType string
 
 const (
-	ssh    connectionType = "ssh"
-	winrm  connectionType = "winrm"
-	docker connectionType = "docker"
-	podman connectionType = "podman"
-	lxc    connectionType = "lxc"
+	ssh       connectionType = "ssh"
+	winrm     connectionType = "winrm"
+	docker    connectionType = "docker"
+	podman    connectionType = "podman"
+	lxc       connectionType = "lxc"
+	lxd       connectionType = "lxd"
+	incus     connectionType = "incus"
+	paramiko  connectionType = "paramiko"
+	ansible   connectionType = "ansible"
+	kubectl   connectionType = "kubectl"
+	openshift connectionType = "openshift"
+	salt      connectionType = "salt"
+	chroot    connectionType = "chroot"
+	local     connectionType = "local"
 )
 
-var connectionTypes = []connectionType{ssh, winrm, docker, podman, lxc}
+var connectionTypes = []connectionType{ssh, winrm, docker, podman, lxc, lxd, incus, paramiko, ansible, kubectl, openshift, salt, chroot, local}
 
 // connection type conversion
 func (a connectionType) New() (connectionType, error) {
@@ -54,9 +136,198 @@ func (a connectionType) New() (connectionType, error) {
 	return a, nil
 }
 
-// helper function to transfer files from local device to temporary packer instance
-func uploadFiles(comm packer.Communicator, files []string, destDir string) error {
+// reserved hosts entry for the automatically determined packer communicator
+const packerHost = "packer"
+
+// helper function to mask the passwords within the uris of a string; the user information of each uri ends at its last @ prior to the next uri, so passwords may contain @ and , characters
+func maskPasswords(str string) string {
+	var masked strings.Builder
+
+	for {
+		scheme := strings.Index(str, "://")
+		if scheme < 0 {
+			break
+		}
+		masked.WriteString(str[:scheme+3])
+		str = str[scheme+3:]
+
+		// determine the uri up to the next uri
+		uri := str
+		if next := strings.Index(str, "://"); next >= 0 {
+			uri = str[:next]
+		}
+		if at := strings.LastIndex(uri, "@"); at >= 0 {
+			if user, _, found := strings.Cut(uri[:at], ":"); found && len(user) > 0 && !strings.ContainsAny(user, "/@,") {
+				masked.WriteString(user + ":****@")
+				str = str[at+1:]
+			}
+		}
+	}
+	masked.WriteString(str)
+
+	return masked.String()
+}
+
+// helper function to display the testinfra hosts from command args with passwords masked
+func displayHosts(args []string) string {
+	for _, arg := range args {
+		if hosts, found := strings.CutPrefix(arg, "--hosts="); found {
+			return maskPasswords(hosts)
+		}
+	}
+
+	return "the default host"
+}
+
+// helper function to append connection backend options to the testinfra hosts argument
+func appendBackendOptions(hostsArg string, options map[string]string) string {
+	if len(options) == 0 {
+		return hostsArg
+	}
+
+	// sort option keys for a deterministic argument
+	query := make([]string, 0, len(options))
+	for _, key := range slices.Sorted(maps.Keys(options)) {
+		query = append(query, fmt.Sprintf("%s=%s", key, options[key]))
+	}
+
+	// hosts argument may already contain options from packer data
+	separator := "?"
+	if strings.Contains(hostsArg, "?") {
+		separator = "&"
+	}
+
+	return hostsArg + separator + strings.Join(query, "&")
+}
+
+// temporary artifacts created by the provisioner and tracked for removal
+type tmpArtifacts struct {
+	mutex   sync.Mutex
+	paths   []string
+	closers []io.Closer
+	sshAuth *tmpSSHAuth
+}
+
+// ssh authentication from a temporary private key file or ephemeral agent for a private key
+type tmpSSHAuth struct {
+	privateKey string
+	authType   sshAuth
+	authString string
+}
+
+// helper method to return the provisioner temporary artifacts tracker
+func (provisioner *Provisioner) artifacts() *tmpArtifacts {
+	if provisioner.tmpArtifacts == nil {
+		provisioner.tmpArtifacts = &tmpArtifacts{}
+	}
+
+	return provisioner.tmpArtifacts
+}
+
+// helper method to create a tracked temporary file accessible only by the owner
+func (provisioner *Provisioner) tmpFile(prefix string) (*os.File, error) {
+	tmpFile, err := tmp.File(prefix)
+	if err != nil {
+		return nil, err
+	}
+	provisioner.trackTmpArtifact(tmpFile.Name())
+
+	// enforce owner read and write only
+	if err = tmpFile.Chmod(0o600); err != nil {
+		log.Printf("unable to restrict permissions for temporary file: %s", tmpFile.Name())
+		tmpFile.Close()
+		return nil, err
+	}
+
+	return tmpFile, nil
+}
+
+// helper method to track a temporary artifact for removal
+func (provisioner *Provisioner) trackTmpArtifact(path string) {
+	artifacts := provisioner.artifacts()
+	artifacts.mutex.Lock()
+	defer artifacts.mutex.Unlock()
+
+	log.Printf("tracking temporary artifact for removal: %s", path)
+	artifacts.paths = append(artifacts.paths, path)
+}
+
+// helper method to track a temporary resource (e.g. listener) for closing
+func (provisioner *Provisioner) trackTmpCloser(closer io.Closer) {
+	artifacts := provisioner.artifacts()
+	artifacts.mutex.Lock()
+	defer artifacts.mutex.Unlock()
+
+	artifacts.closers = append(artifacts.closers, closer)
+}
+
+// helper method to track the ssh authentication created from a private key for reuse
+func (provisioner *Provisioner) trackTmpSSHAuth(sshPrivateKey string, authType sshAuth, authString string) {
+	artifacts := provisioner.artifacts()
+	artifacts.mutex.Lock()
+	defer artifacts.mutex.Unlock()
+
+	artifacts.sshAuth = &tmpSSHAuth{privateKey: sshPrivateKey, authType: authType, authString: authString}
+}
+
+// helper method to return the tracked ssh authentication created from the private key as the same type if it exists
+func (provisioner *Provisioner) trackedTmpSSHAuth(sshPrivateKey string, authType sshAuth) (string, bool) {
+	artifacts := provisioner.artifacts()
+	artifacts.mutex.Lock()
+	defer artifacts.mutex.Unlock()
+
+	if artifacts.sshAuth == nil || artifacts.sshAuth.privateKey != sshPrivateKey || artifacts.sshAuth.authType != authType {
+		return "", false
+	}
+
+	return artifacts.sshAuth.authString, true
+}
+
+// helper method to close and remove all tracked temporary artifacts
+func (provisioner *Provisioner) cleanupTmpArtifacts() {
+	artifacts := provisioner.artifacts()
+	artifacts.mutex.Lock()
+	defer artifacts.mutex.Unlock()
+
+	// close resources prior to removing their paths
+	for _, closer := range artifacts.closers {
+		if err := closer.Close(); err != nil {
+			log.Printf("failed to close temporary resource: %s", err)
+		}
+	}
+	artifacts.closers = nil
+
+	for _, path := range artifacts.paths {
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("failed to remove temporary artifact at %s: %s", path, err)
+			log.Print("temporary artifact must be removed manually")
+		} else {
+			log.Printf("removed temporary artifact: %s", path)
+		}
+	}
+	artifacts.paths = nil
+	artifacts.sshAuth = nil
+}
+
+// helper method to set an environment variable determined from communication for testinfra execution
+func (provisioner *Provisioner) setCommEnv(key string, value string) {
+	if provisioner.commEnv == nil {
+		provisioner.commEnv = map[string]string{}
+	}
+
+	provisioner.commEnv[key] = value
+}
+
+// helper function to single quote a string for the shell
+func shellQuote(str string) string {
+	return "'" + strings.ReplaceAll(str, "'", `'\''`) + "'"
+}
+
+// helper function to transfer files from local device to temporary packer instance, preserving structure relative to their root directories
+func uploadFiles(ctx context.Context, comm packer.Communicator, files []string, roots map[string]string, destDir string) error {
 	var err error
+	// track created destination subdirectories
+	createdDirs := map[string]bool{}
 
 	// iterate through files to transfer
 	for _, file := range files {
@@ -80,8 +351,24 @@ func uploadFiles(comm packer.Communicator, files []string, destDir string) error
 		}
 		fileIo := bytes.NewReader(fileBytes)
 
-		// upload file to destination dir
-		destination := fmt.Sprintf("%s/%s", destDir, filepath.Base(file))
+		// determine destination path relative to root directory of expanded files
+		relPath := relativePath(file, roots)
+		destination := fmt.Sprintf("%s/%s", destDir, relPath)
+
+		// create destination subdirectory
+		if subDir := path.Dir(relPath); subDir != "." && !createdDirs[subDir] {
+			mkdirCmd := &packer.RemoteCmd{Command: fmt.Sprintf("mkdir -p %s", shellQuote(fmt.Sprintf("%s/%s", destDir, subDir)))}
+			if nestedErr := comm.Start(ctx, mkdirCmd); nestedErr != nil || mkdirCmd.Wait() != 0 {
+				// join error into collection
+				err = errors.Join(err, fmt.Errorf("unable to create directory %s/%s", destDir, subDir))
+
+				log.Printf("the directory %s/%s could not be created on the temporary Packer instance", destDir, subDir)
+				continue
+			}
+			createdDirs[subDir] = true
+		}
+
+		// upload file to destination
 		if nestedErr := comm.Upload(destination, fileIo, nil); nestedErr != nil {
 			// join error into collection
 			err = errors.Join(err, nestedErr)
@@ -95,3 +382,258 @@ func uploadFiles(comm packer.Communicator, files []string, destDir string) error
 	// the logger displays the relevant debugging information, and this return is useful only in a nil comparable context, and not for specific error types UNLESS only one error is returned
 	return err
 }
+
+// helper function to determine the slash separated path of a file relative to its root directory, or otherwise its base name
+func relativePath(file string, roots map[string]string) string {
+	if root, ok := roots[file]; ok {
+		if rel, err := filepath.Rel(root, file); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.Base(file)
+}
+
+// helper function to expand test file globs and directories into files without duplicates, and return them with their root directories
+func expandTestFiles(testFiles []string) ([]string, map[string]string, error) {
+	var files []string
+	roots := map[string]string{}
+	expanded := map[string]bool{}
+
+	for _, testFile := range testFiles {
+		var matches []string
+		var root string
+
+		if strings.ContainsAny(testFile, "*?[") {
+			// glob pattern is matched within its static root directory
+			var pattern []string
+			root, pattern = globRoot(testFile)
+			walkErr := filepath.WalkDir(root, func(file string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if entry.IsDir() {
+					if skipTestDir(root, file, entry) {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				rel, err := filepath.Rel(root, file)
+				if err != nil {
+					return err
+				}
+				if matchGlob(pattern, strings.Split(filepath.ToSlash(rel), "/")) {
+					matches = append(matches, file)
+				}
+				return nil
+			})
+			if walkErr != nil && !errors.Is(walkErr, fs.ErrNotExist) {
+				log.Printf("the Testinfra test_files pattern could not be expanded: %s", testFile)
+				return nil, nil, walkErr
+			}
+		} else {
+			info, err := os.Stat(testFile)
+			if err != nil {
+				log.Printf("the Testinfra test_file does not exist or cannot be accessed at: %s", testFile)
+				return nil, nil, err
+			}
+
+			if !info.IsDir() {
+				// file requires no expansion
+				if !expanded[filepath.Clean(testFile)] {
+					expanded[filepath.Clean(testFile)] = true
+					files = append(files, testFile)
+				}
+				continue
+			}
+
+			// directory is expanded into the test modules pytest would discover
+			root = testFile
+			walkErr := filepath.WalkDir(root, func(file string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if skipTestDir(root, file, entry) {
+					return filepath.SkipDir
+				}
+				if name := entry.Name(); !entry.IsDir() && strings.HasSuffix(name, ".py") && (strings.HasPrefix(name, "test_") || strings.HasSuffix(name, "_test.py")) {
+					matches = append(matches, file)
+				}
+				return nil
+			})
+			if walkErr != nil {
+				log.Printf("the Testinfra test_files directory could not be expanded: %s", testFile)
+				return nil, nil, walkErr
+			}
+		}
+
+		if len(matches) == 0 {
+			log.Printf("the Testinfra test_files entry matched no files: %s", testFile)
+			return nil, nil, errors.New("test files pattern matched nothing")
+		}
+
+		// deterministic order within each entry, and the first occurrence of files matched by multiple entries
+		slices.Sort(matches)
+		for _, match := range matches {
+			if expanded[match] {
+				log.Printf("the Testinfra test_files entry %s also matched, and will not duplicate, the test file: %s", testFile, match)
+				continue
+			}
+			expanded[match] = true
+			files = append(files, match)
+			roots[match] = root
+		}
+	}
+
+	return files, roots, nil
+}
+
+// helper function to determine whether a directory is skipped during test file expansion (hidden, dependency, and cache directories)
+func skipTestDir(root string, dir string, entry fs.DirEntry) bool {
+	return entry.IsDir() && dir != root && (strings.HasPrefix(entry.Name(), ".") || slices.Contains([]string{"__pycache__", "node_modules"}, entry.Name()))
+}
+
+// helper function to split a glob into its static root directory and remaining pattern segments
+func globRoot(glob string) (string, []string) {
+	segments := strings.Split(filepath.ToSlash(glob), "/")
+
+	// root is all segments preceding the first with glob characters
+	index := slices.IndexFunc(segments, func(segment string) bool { return strings.ContainsAny(segment, "*?[") })
+	root := strings.Join(segments[:index], "/")
+	if len(root) == 0 {
+		if strings.HasPrefix(glob, "/") {
+			root = "/"
+		} else {
+			root = "."
+		}
+	}
+
+	return filepath.FromSlash(root), segments[index:]
+}
+
+// helper function to match path segments against glob pattern segments, where '**' matches zero or more segments
+func matchGlob(pattern []string, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		// match zero segments, or consume one segment and retry
+		return matchGlob(pattern[1:], segments) || (len(segments) > 0 && matchGlob(pattern, segments[1:]))
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+	if matched, err := path.Match(pattern[0], segments[0]); err != nil || !matched {
+		return false
+	}
+
+	return matchGlob(pattern[1:], segments[1:])
+}
+
+// helper function to verify the sha256 digests of files against the checksums keyed by path (relative to the root directory if specified, or otherwise the current working directory)
+func verifyChecksums(files []string, checksums map[string]string, root string) error {
+	// normalize checksum paths and digests
+	digests := make(map[string]string, len(checksums))
+	for file, digest := range checksums {
+		digest = strings.ToLower(strings.TrimPrefix(digest, "sha256:"))
+		if decoded, err := hex.DecodeString(digest); err != nil || len(decoded) != sha256.Size {
+			log.Printf("the checksum for '%s' is not a valid sha256 digest: %s", file, checksums[file])
+			return errors.New("invalid test file checksum")
+		}
+		absFile, err := filepath.Abs(filepath.Join(root, file))
+		if err != nil {
+			return err
+		}
+		digests[absFile] = digest
+	}
+
+	verified := map[string]bool{}
+	for _, file := range files {
+		// determine checksum for file
+		absFile, err := filepath.Abs(file)
+		if err != nil {
+			return err
+		}
+		if verified[absFile] {
+			continue
+		}
+		key := filepath.Clean(file)
+		if len(root) > 0 {
+			if key, err = filepath.Rel(root, file); err != nil {
+				return err
+			}
+		}
+		expected, ok := digests[absFile]
+		if !ok {
+			log.Printf("the test file has no checksum: %s", key)
+			return errors.New("missing test file checksum")
+		}
+
+		// compute and compare sha256 digest
+		content, err := os.ReadFile(file)
+		if err != nil {
+			log.Printf("the test file could not be read for checksum verification: %s", file)
+			return err
+		}
+		actual := sha256.Sum256(content)
+		if digest := hex.EncodeToString(actual[:]); digest != expected {
+			log.Printf("the test file '%s' sha256 digest '%s' does not match the checksum '%s'", key, digest, expected)
+			return errors.New("test file checksum mismatch")
+		}
+		log.Printf("verified test file '%s' with sha256 digest: %s", key, expected)
+		verified[absFile] = true
+	}
+
+	return nil
+}
+
+// helper function to determine the conftest.py modules loaded by pytest in support of the test files: within each test file directory, and the ancestor directories up to the test file root
+func supportingFiles(testFiles []string, roots map[string]string) ([]string, error) {
+	var files []string
+
+	for _, testFile := range testFiles {
+		// ancestor directories are only determinable for expanded test files
+		dir := filepath.Dir(testFile)
+		root, ok := roots[testFile]
+		if ok {
+			root = filepath.Clean(root)
+		}
+
+		for {
+			if conftest := filepath.Join(dir, "conftest.py"); !slices.Contains(files, conftest) {
+				if info, err := os.Stat(conftest); err == nil && info.Mode().IsRegular() {
+					files = append(files, conftest)
+				} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+					log.Printf("the supporting conftest.py could not be accessed: %s", conftest)
+					return nil, err
+				}
+			}
+
+			if !ok || dir == root || dir == filepath.Dir(dir) {
+				break
+			}
+			dir = filepath.Dir(dir)
+		}
+	}
+
+	return files, nil
+}
+
+// helper method to verify the config file, and the test files with their supporting conftest.py modules (unless within the test source which is verified when fetched), against the checksums
+func (provisioner *Provisioner) verifyTestFiles(testFiles []string) error {
+	var files []string
+	if len(provisioner.config.ConfigFile) > 0 {
+		files = append(files, provisioner.config.ConfigFile)
+	}
+
+	if len(provisioner.config.TestSource) == 0 {
+		supportFiles, err := supportingFiles(testFiles, provisioner.testFileRoots)
+		if err != nil {
+			return err
+		}
+		files = slices.Concat(files, testFiles, supportFiles)
+	}
+
+	return verifyChecksums(files, provisioner.config.Checksums, "")
+}